@@ -104,7 +104,7 @@ func main() {
 
 	dict := pinyin.NewDict()
 	s := dict.Convert(`浪漫反应`, " ").ASCII()
-	fmt.Println(s)
+	fmt.Fprintln(os.Stderr, s)
 	// return
 
 	// Open file
@@ -118,6 +118,9 @@ func main() {
 	rows, err := f.GetRows(activeSheet)
 	panicIf(err)
 
+	// Output the "cards" object of the content file (src/content.json)
+	fmt.Println("{")
+	count := 0
 	occurrenceRowIndex := make(map[string]int) // For deduplication
 	for i, row := range rows {
 		card, err := tryParseRow(row)
@@ -130,12 +133,15 @@ func main() {
 				continue
 			}
 			occurrenceRowIndex[card.Name] = i
-			fmt.Printf(`"%s": {[]int{%s}, %d, [3]int{%s}},`+"\n",
+			if count > 0 {
+				fmt.Println(",")
+			}
+			count++
+			fmt.Printf(`  "%s": [[%s], %d, [%s]]`,
 				card.Name, commaSep(card.Condition), card.Growth, commaSep(card.RelationshipChange[:]))
-			// fmt.Printf(`"%s": [[%s], %d, [%s]],`+"\n",
-			// 	card.Name, commaSep(card.Condition), card.Growth, commaSep(card.RelationshipChange[:]))
 		} else {
 			fmt.Fprintf(os.Stderr, "Skipped row %d (%v)\n", i+1, err)
 		}
 	}
+	fmt.Println("\n}")
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+////// Bots //////
+// Bots take seats that no one else fills. They have negative user IDs
+// (-1 being reserved for timeouts), and play through the same commands
+// as everyone else, so their moves are recorded and replayed alike.
+// Their own choices need not be reproducible, hence `math/rand`
+// rather than the game's generator
+
+// Decisions of a bot, given the state of the game and its own seat
+type BotStrategy interface {
+	// Whether to become the starting player when appointed
+	AcceptAppointment(s *GameplayState, seat int) bool
+	// Hand index, arena index and target seat (-1 for none)
+	ChooseAction(s *GameplayState, seat int) (int, int, int)
+	// Whether to raise a hand while another player is storytelling.
+	// Should not vary between calls on the same state
+	WantsQueue(s *GameplayState, seat int) bool
+	// A line of storytelling for the current action
+	StoryLine(s *GameplayState, seat int) string
+}
+
+var BotStrategies = map[string]BotStrategy{
+	"default": BotStrategyDefault{},
+	"random":  BotStrategyRandom{},
+}
+
+// Pause before a bot acts, so that its moves can be followed
+const BotThinkTime = 2 * time.Second
+
+func NewBotPlayer(userId int, strategy string) GameplayPlayer {
+	user := User{Id: userId, Nickname: fmt.Sprintf("小天线 %d", -userId-1)}
+	var stats [8]int
+	for i := range stats {
+		stats[i] = 30 + rand.IntN(41)
+	}
+	return GameplayPlayer{
+		User: user,
+		Profile: Profile{
+			Id:      0,
+			Creator: userId,
+			Details: "{}",
+			Stats:   stats,
+			Traits:  []string{},
+		},
+		Ready: true,
+		Bot:   strategy,
+	}
+}
+
+func (p GameplayPlayer) IsBot() bool {
+	return p.Bot != ""
+}
+
+// Profiles of bots are not in the database
+func (p GameplayPlayer) BotRepr() OrderedKeysMarshal {
+	return OrderedKeysMarshal{
+		{"id", nil},
+		{"creator", p.User.Repr()},
+		{"details", DirectMarshal(p.Profile.Details)},
+		{"stats", p.Profile.Stats},
+		{"traits", p.Profile.Traits},
+		{"bot", p.Bot},
+	}
+}
+
+// Probability that a card succeeds with the given stats, following `ActionCheck`
+func cardSuccessChance(card Card, stats [8]int) float64 {
+	succeeded := 0
+	for difficulty := range 100 {
+		if difficulty <= 5 {
+			succeeded++
+			continue
+		} else if difficulty >= 90 {
+			continue
+		}
+		count := 0
+		for _, statIndex := range card.Condition {
+			if stats[statIndex] >= difficulty {
+				count++
+			}
+		}
+		if count*2 >= len(card.Condition) {
+			succeeded++
+		}
+	}
+	return float64(succeeded) / 100
+}
+
+// Plays the card most likely to succeed, and reaches out to
+// the player it is least attached to when the odds are good
+type BotStrategyDefault struct{}
+
+func (BotStrategyDefault) bestCard(s *GameplayState, seat int) (int, float64) {
+	st := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	best, bestChance := 0, -1.0
+	for i, name := range st.Player[seat].Hand {
+		chance := cardSuccessChance(s.Content.Cards[name], s.Players[seat].Profile.Stats)
+		if chance > bestChance {
+			best, bestChance = i, chance
+		}
+	}
+	return best, bestChance
+}
+
+func (BotStrategyDefault) AcceptAppointment(s *GameplayState, seat int) bool {
+	return true
+}
+
+func (b BotStrategyDefault) ChooseAction(s *GameplayState, seat int) (int, int, int) {
+	st := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	handIndex, chance := b.bestCard(s, seat)
+	arenaIndex := rand.IntN(len(st.Arena))
+	target := -1
+	if chance >= 0.5 {
+		var lowest float32
+		for i, r := range st.Player[seat].Relationship {
+			if i == seat {
+				continue
+			}
+			sum := r[0] + r[1] + r[2]
+			if target == -1 || sum < lowest {
+				target, lowest = i, sum
+			}
+		}
+	}
+	return handIndex, arenaIndex, target
+}
+
+func (b BotStrategyDefault) WantsQueue(s *GameplayState, seat int) bool {
+	_, chance := b.bestCard(s, seat)
+	return chance >= 0.6
+}
+
+func (BotStrategyDefault) StoryLine(s *GameplayState, seat int) string {
+	return botStoryLine(s, seat)
+}
+
+// Acts as a timed-out player would, without ever raising a hand
+type BotStrategyRandom struct{}
+
+func (BotStrategyRandom) AcceptAppointment(s *GameplayState, seat int) bool {
+	return rand.IntN(2) == 0
+}
+
+func (BotStrategyRandom) ChooseAction(s *GameplayState, seat int) (int, int, int) {
+	st := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	target := rand.IntN(len(s.Players)+1) - 1
+	return rand.IntN(len(st.Player[seat].Hand)), rand.IntN(len(st.Arena)), target
+}
+
+func (BotStrategyRandom) WantsQueue(s *GameplayState, seat int) bool {
+	return false
+}
+
+func (BotStrategyRandom) StoryLine(s *GameplayState, seat int) string {
+	return botStoryLine(s, seat)
+}
+
+var botStoryOpenings = []string{
+	"说到「%[1]s」，我想起了一段往事，于是%[2]s。",
+	"「%[1]s」就在眼前，我决定%[2]s。",
+	"关于「%[1]s」，我只记得那天我%[2]s。",
+}
+var botStoryTargets = []string{
+	"这件事与【%s】有关。",
+	"【%s】也在场。",
+}
+var botStoryResults = map[int][]string{
+	2:  {"一切顺利得不可思议！", "这是我最得意的一次。"},
+	1:  {"结果还算顺利。", "事情总算办成了。"},
+	-1: {"可惜事与愿违。", "结果并不如意。"},
+	-2: {"结果一塌糊涂……", "那真是糟糕透顶的一天。"},
+}
+
+// Templated storytelling, from the storyteller's side of the current action
+func botStoryLine(s *GameplayState, seat int) string {
+	st := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	keyword := st.Arena[st.Keyword]
+	result := st.HolderResult
+	line := fmt.Sprintf(botStoryOpenings[rand.IntN(len(botStoryOpenings))], keyword, st.Action)
+	if seat == st.Holder && st.Target != -1 {
+		line += fmt.Sprintf(botStoryTargets[rand.IntN(len(botStoryTargets))], s.Players[st.Target].User.Nickname)
+	} else if seat == st.Target {
+		line = fmt.Sprintf("面对【%s】的「%s」，我有自己的回应。", s.Players[st.Holder].User.Nickname, st.Action)
+		result = st.TargetResult
+	}
+	results := botStoryResults[result]
+	return line + results[rand.IntN(len(results))]
+}
+
+////// Bots in the room //////
+// All assume the mutex is held (Lock'ed)
+
+func (r *GameRoom) AddBot(strategy string) string {
+	if _, ok := BotStrategies[strategy]; !ok {
+		return "Unknown strategy"
+	}
+	userId := -2
+	for _, p := range r.Gameplay.Players {
+		if p.IsBot() && p.User.Id <= userId {
+			userId = p.User.Id - 1
+		}
+	}
+	bot := NewBotPlayer(userId, strategy)
+	err, _ := r.Gameplay.Seat(bot.User, bot.Profile, r.Room.Settings.MaxPlayers)
+	if err != "" {
+		return err
+	}
+	seat := r.Gameplay.PlayerIndex(userId)
+	r.Gameplay.Players[seat] = bot
+	r.BroadcastAssemblyUpdate(-1)
+	r.BroadcastLog(fmt.Sprintf("机器人【%s】坐下", bot.User.Nickname))
+	return ""
+}
+
+func (r *GameRoom) RemoveBot(userId int) string {
+	seat := r.Gameplay.PlayerIndex(userId)
+	if seat == -1 || !r.Gameplay.Players[seat].IsBot() {
+		return "No such bot"
+	}
+	nickname := r.Gameplay.Players[seat].User.Nickname
+	if err, _ := r.Gameplay.WithdrawSeat(userId); err != "" {
+		return err
+	}
+	r.BroadcastAssemblyUpdate(-1)
+	r.BroadcastLog(fmt.Sprintf("机器人【%s】离座", nickname))
+	return ""
+}
+
+// The bot, if any, that has something to do now; -1 if none
+func (r *GameRoom) botToAct() int {
+	s := &r.Gameplay
+	seat := s.ActingSeat()
+	if seat == -1 || s.Paused() {
+		return -1
+	}
+	if s.Players[seat].IsBot() {
+		return seat
+	}
+	// Others may raise their hands while someone is storytelling
+	if st, ok := s.PhaseStatus.(GameplayPhaseStatusGameplay); ok && st.Step != "selection" {
+		for i, p := range s.Players {
+			if p.IsBot() && r.botMayQueue(i) &&
+				BotStrategies[p.Bot].WantsQueue(s, i) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (r *GameRoom) botMayQueue(seat int) bool {
+	st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
+	if seat == st.Holder || st.Player[seat].ActionPoints == 0 {
+		return false
+	}
+	for _, i := range st.Queue {
+		if i == seat {
+			return false
+		}
+	}
+	return true
+}
+
+// Arms the timer for the next bot move, if one is due and none is pending
+func (r *GameRoom) ScheduleBots() {
+	if r.BotTimer != nil || r.botToAct() == -1 {
+		return
+	}
+	signal := r.Signal
+	r.BotTimer = time.AfterFunc(BotThinkTime, func() {
+		signal <- GameRoomSignalTimer{Type: "bot"}
+	})
+}
+
+func (r *GameRoom) StopBots() {
+	if r.BotTimer != nil {
+		r.BotTimer.Stop()
+		r.BotTimer = nil
+	}
+}
+
+// Carries out the due bot move
+func (r *GameRoom) BotStep() {
+	r.BotTimer = nil
+	seat := r.botToAct()
+	if seat == -1 {
+		return
+	}
+	s := &r.Gameplay
+	p := s.Players[seat]
+	strategy := BotStrategies[p.Bot]
+
+	var err string
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		err = r.CommandAppointment(p.User.Id, strategy.AcceptAppointment(s, seat))
+	case GameplayPhaseStatusGameplay:
+		if st.Step == "selection" {
+			handIndex, arenaIndex, target := strategy.ChooseAction(s, seat)
+			err = r.CommandAction(p.User.Id, handIndex, arenaIndex, target)
+		} else if seat == st.Holder || (st.Step == "storytelling_target" && seat == st.Target) {
+			r.BroadcastLog(fmt.Sprintf("机器人【%s】讲述：%s", p.User.Nickname, strategy.StoryLine(s, seat)))
+			err = r.CommandStorytellingEnd(p.User.Id)
+		} else {
+			err = r.CommandQueue(p.User.Id)
+		}
+	}
+	if err != "" {
+		log.Printf("Room %d: bot %d (%s): %s\n", r.Room.Id, p.User.Id, p.Bot, err)
+	}
+}
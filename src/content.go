@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+////// Game content //////
+// Cards and keywords, loaded from a versioned JSON file.
+// Each version is kept in the database once loaded, so that recorded games
+// can be replayed with the content they were played with
+
+type Card struct {
+	Condition          []int
+	Growth             int
+	RelationshipChange [3]int
+}
+
+// Encoded as [condition, growth, relationship change], as in client/cards.json
+func (c Card) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{c.Condition, c.Growth, c.RelationshipChange})
+}
+func (c *Card) UnmarshalJSON(b []byte) error {
+	fields := []interface{}{&c.Condition, &c.Growth, &c.RelationshipChange}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("Card should be of length 3")
+	}
+	return nil
+}
+
+type GameContent struct {
+	Version  int             `json:"version"`
+	Cards    map[string]Card `json:"cards"`
+	Keywords []string        `json:"keywords"`
+
+	// Sorted, as map iteration order varies between processes
+	// and would otherwise break replays of recorded games
+	CardNames []string `json:"-"`
+}
+
+// Fewest entries to fill a hand and the smallest arena without repetition
+const ContentMinCards = 5
+const ContentMinKeywords = 3
+
+// Condition indices refer to the eight stats (Se, Si, Ne, Ni, Te, Ti, Fe, Fi)
+const ContentNumStats = 8
+
+func ParseGameContent(data []byte) (*GameContent, error) {
+	c := &GameContent{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if c.Version <= 0 {
+		return nil, fmt.Errorf("Version should be positive")
+	}
+
+	// Duplicate object keys are silently merged by the decoder
+	var raw struct {
+		Cards json.RawMessage `json:"cards"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if name, ok := duplicateObjectKey(raw.Cards); ok {
+		return nil, fmt.Errorf("Duplicate card \"%s\"", name)
+	}
+
+	for name, card := range c.Cards {
+		if name == "" {
+			return nil, fmt.Errorf("Empty card name")
+		}
+		for _, index := range card.Condition {
+			if index < 0 || index >= ContentNumStats {
+				return nil, fmt.Errorf("Card \"%s\": condition index %d out of range", name, index)
+			}
+		}
+		if card.Growth < 0 {
+			return nil, fmt.Errorf("Card \"%s\": negative growth", name)
+		}
+		c.CardNames = append(c.CardNames, name)
+	}
+	sort.Strings(c.CardNames)
+	if len(c.CardNames) < ContentMinCards {
+		return nil, fmt.Errorf("At least %d cards are required", ContentMinCards)
+	}
+
+	keywords := map[string]struct{}{}
+	for _, keyword := range c.Keywords {
+		if keyword == "" {
+			return nil, fmt.Errorf("Empty keyword")
+		}
+		if _, ok := keywords[keyword]; ok {
+			return nil, fmt.Errorf("Duplicate keyword \"%s\"", keyword)
+		}
+		keywords[keyword] = struct{}{}
+	}
+	if len(c.Keywords) < ContentMinKeywords {
+		return nil, fmt.Errorf("At least %d keywords are required", ContentMinKeywords)
+	}
+
+	return c, nil
+}
+
+func duplicateObjectKey(data []byte) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return "", false
+	}
+	keys := map[string]struct{}{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		key := t.(string)
+		if _, ok := keys[key]; ok {
+			return key, true
+		}
+		keys[key] = struct{}{}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// Canonical encoding, for comparison against the recorded version
+func (c *GameContent) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+var currentContent atomic.Pointer[GameContent]
+
+var contentVersions = map[int]*GameContent{}
+var contentVersionsMutex sync.Mutex
+
+// Content for newly started games
+func CurrentContent() *GameContent {
+	return currentContent.Load()
+}
+
+// Reads the content file, and makes it current if valid.
+// A changed content must come with a new version
+func LoadContent() error {
+	data, err := os.ReadFile(Config.Content)
+	if err != nil {
+		return err
+	}
+	c, err := ParseGameContent(data)
+	if err != nil {
+		return err
+	}
+	encoded := c.Encode()
+	if recorded, ok := ContentDataLoad(c.Version); !ok {
+		ContentDataSave(c.Version, encoded)
+	} else if recorded != encoded {
+		return fmt.Errorf("Content of version %d has changed; please bump the version", c.Version)
+	}
+
+	contentVersionsMutex.Lock()
+	contentVersions[c.Version] = c
+	contentVersionsMutex.Unlock()
+	currentContent.Store(c)
+	log.Printf("Loaded content version %d (%d cards, %d keywords)\n",
+		c.Version, len(c.Cards), len(c.Keywords))
+	return nil
+}
+
+// Content of a given version, as recorded in the database.
+// Returns nil if the version is unknown
+func ContentByVersion(version int) *GameContent {
+	contentVersionsMutex.Lock()
+	defer contentVersionsMutex.Unlock()
+	if c, ok := contentVersions[version]; ok {
+		return c
+	}
+	data, ok := ContentDataLoad(version)
+	if !ok {
+		return nil
+	}
+	c, err := ParseGameContent([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	contentVersions[version] = c
+	return c
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,11 @@ import (
 type WebSocketConn struct {
 	User
 	OutChannel chan interface{}
+	// Chosen at connection; spectators watch without taking a seat
+	Spectator bool
+	// Set until the room has sent the state or replayed missed messages;
+	// live messages are only recorded meanwhile, so that none arrives twice
+	Pending bool
 }
 
 type GameRoomInMessage struct {
@@ -22,19 +29,27 @@ type GameRoomInMessage struct {
 }
 
 type GameRoomSignalNewConn struct {
-	UserId int
-}
-type GameRoomSignalLostConn struct {
 	UserId  int
 	Channel chan interface{}
 }
-type GameRoomSignalReEstConn struct {
+type GameRoomSignalLostConn struct {
 	UserId int
+	// Whether the connection was still current (not replaced by a reconnection)
+	Removed bool
+}
+type GameRoomSignalReEstConn struct {
+	UserId  int
+	Channel chan interface{}
+	LastSeq int
 }
 type GameRoomSignalTimer struct {
 	Type string
 }
 
+// The room record was changed from outside; wakes the room up
+// to announce the change to the lobby
+type GameRoomSignalRoomUpdate struct{}
+
 ////// Miscellaneous utilities //////
 
 func validOrNil(valid bool, val interface{}) interface{} {
@@ -49,6 +64,9 @@ type PeekableTimer struct {
 	Timer   *time.Timer
 	Expires time.Time
 	Func    func()
+	// A paused timer is stopped, keeping the remaining duration
+	Paused bool
+	Left   time.Duration
 }
 
 func NewPeekableTimer(d time.Duration) PeekableTimer {
@@ -59,20 +77,37 @@ func NewPeekableTimer(d time.Duration) PeekableTimer {
 	}
 }
 
+// A nil `f` gives an inert timer that only keeps track of the expiry
 func NewPeekableTimerFunc(d time.Duration, f func()) PeekableTimer {
+	if f == nil {
+		return PeekableTimer{
+			Timer:   nil,
+			Expires: time.Now().Add(d),
+			Func:    nil,
+		}
+	}
+	// Expiry taken first, so that it has passed once `f` is called
+	expires := time.Now().Add(d)
 	return PeekableTimer{
 		Timer:   time.AfterFunc(d, f),
-		Expires: time.Now().Add(d),
+		Expires: expires,
 		Func:    f,
 	}
 }
 
 func (t PeekableTimer) Remaining() time.Duration {
+	if t.Paused {
+		return t.Left
+	}
 	return t.Expires.Sub(time.Now())
 }
 
 func (t *PeekableTimer) Reset(d time.Duration) {
-	if t.Timer == nil || !t.Timer.Stop() {
+	t.Paused = false
+	t.Expires = time.Now().Add(d)
+	if t.Timer == nil && t.Func == nil {
+		// Inert
+	} else if t.Timer == nil || !t.Timer.Stop() {
 		if t.Func == nil {
 			t.Timer = time.NewTimer(d)
 		} else {
@@ -81,7 +116,6 @@ func (t *PeekableTimer) Reset(d time.Duration) {
 	} else {
 		t.Timer.Reset(d)
 	}
-	t.Expires = time.Now().Add(d)
 }
 
 func (t *PeekableTimer) Stop() {
@@ -90,177 +124,67 @@ func (t *PeekableTimer) Stop() {
 	}
 }
 
-////// Card set settings //////
+// Absolute expiry for clients (Unix timestamp in milliseconds);
+// nil if paused or inert, as the expiry does not approach
+func (t PeekableTimer) Deadline() interface{} {
+	inert := (t.Timer == nil && t.Func == nil)
+	return validOrNil(!t.Paused && !inert, t.Expires.UnixMilli())
+}
 
-type Card struct {
-	Condition          []int
-	Growth             int
-	RelationshipChange [3]int
+func (t *PeekableTimer) Pause() {
+	if t.Paused {
+		return
+	}
+	t.Left = max(t.Remaining(), 0)
+	t.Stop()
+	t.Paused = true
 }
 
-var CardSet map[string]Card = func() map[string]Card {
-	const (
-		Se = iota
-		Si
-		Ne
-		Ni
-		Te
-		Ti
-		Fe
-		Fi
-	)
-	return map[string]Card{
-		"吸引关注": {[]int{0, 4, 3, 2}, 1, [3]int{2, 0, 0}},
-		"散发性感": {[]int{0, 7}, 1, [3]int{3, 0, 0}},
-		"凝视":   {[]int{7, 0, 2}, 1, [3]int{2, 1, 0}},
-		"微笑":   {[]int{6}, 1, [3]int{0, 2, 0}},
-		"触碰":   {[]int{0, 1}, 1, [3]int{3, 2, 1}},
-		"牵手":   {[]int{2, 0, 6}, 1, [3]int{3, 3, 1}},
-		"共舞":   {[]int{0, 6, 2, 3}, 1, [3]int{5, 5, 0}},
-		"拥抱":   {[]int{6, 0, 7, 3}, 1, [3]int{2, 5, 1}},
-		"分享":   {[]int{6, 2, 4}, 1, [3]int{2, 3, 0}},
-		"倾诉":   {[]int{6, 4, 7, 1, 2}, 1, [3]int{1, 3, 5}},
-		"倾听":   {[]int{6, 5, 3, 1, 7}, 1, [3]int{0, 8, 5}},
-		"同情":   {[]int{6, 7}, 1, [3]int{0, 1, 1}},
-		"安慰":   {[]int{6, 7, 4, 5, 2, 3}, 1, [3]int{0, 2, 2}},
-		"共情":   {[]int{6, 7, 2, 3, 1, 0}, 1, [3]int{0, 5, 0}},
-		"理解":   {[]int{5, 4, 3, 2, 1, 0}, 1, [3]int{1, 2, 2}},
-		"指责":   {[]int{4, 7, 6, 3, 1}, 1, [3]int{5, -2, -2}},
-		"分手":   {[]int{5, 4, 2, 3, 1, 0, 7}, 1, [3]int{-9, -9, -9}},
-		"共鸣":   {[]int{7, 6, 4, 5, 1, 0, 2, 3}, 1, [3]int{2, 9, 2}},
-		"邀约":   {[]int{7, 2, 4, 6, 3, 0}, 1, [3]int{3, 2, 1}},
-		"赠礼":   {[]int{6, 4, 2, 3}, 1, [3]int{1, 1, 2}},
-		"投食":   {[]int{6, 1}, 1, [3]int{2, 5, 1}},
-		"照料":   {[]int{6, 0, 1}, 1, [3]int{-1, 3, 9}},
-		"告白":   {[]int{7, 6, 4, 2}, 1, [3]int{5, 5, 3}},
-		"亲吻":   {[]int{0, 1, 7, 6}, 1, [3]int{5, 8, 0}},
-		"性爱":   {[]int{0, 7}, 2, [3]int{9, 8, 0}},
-		"约定终身": {[]int{7, 1, 6, 4, 3}, 3, [3]int{3, 5, 9}},
-		"刺杀":   {[]int{0, 3, 4}, 3, [3]int{5, -9, -9}},
-		"做饭":   {[]int{0, 1, 7, 6, 2}, 1, [3]int{1, 3, 3}},
-		"吃喝":   {[]int{0, 1, 7, 6, 2}, 1, [3]int{2, 3, 3}},
-		"睡觉":   {[]int{0, 1}, 1, [3]int{1, 1, 1}},
-		"上厕所":  {[]int{0, 1}, 1, [3]int{1, 0, 3}},
-		"外出":   {[]int{0, 2}, 1, [3]int{0, 3, 1}},
-		"窥视":   {[]int{2, 7}, 2, [3]int{5, 5, -9}},
-		"违法":   {[]int{2, 5, 3, 7}, 3, [3]int{5, -2, -9}},
-		"努力工作": {[]int{4, 3, 7, 6}, 1, [3]int{2, 1, 9}},
-		"开枪":   {[]int{0, 3}, 3, [3]int{5, -8, 1}},
-		"自残":   {[]int{7, 6, 5}, 3, [3]int{3, -3, -9}},
-		"治疗":   {[]int{6, 1, 5, 2, 3, 4}, 2, [3]int{1, 1, 8}},
-		"求医":   {[]int{1, 6, 3, 0}, 2, [3]int{0, 3, 3}},
-		"作弊":   {[]int{0, 5, 4}, 1, [3]int{3, -3, -8}},
-		"背叛":   {[]int{0, 3, 5, 2}, 2, [3]int{-2, -5, -5}},
-		"恐吓":   {[]int{1, 4, 3, 0}, 2, [3]int{3, -5, -8}},
-		"交易":   {[]int{5, 4, 2, 3}, 1, [3]int{1, 1, 2}},
-		"出老千":  {[]int{0, 3, 2, 5}, 1, [3]int{-1, -2, -5}},
-		"忍气吞声": {[]int{1, 6, 4, 3}, 2, [3]int{3, -1, -1}},
-		"冥想":   {[]int{1, 3, 2, 0}, 1, [3]int{2, 2, 1}},
-		"朝拜":   {[]int{3, 2, 7, 6}, 1, [3]int{3, 3, -1}},
-		"竞争":   {[]int{4, 3, 1, 0, 7}, 2, [3]int{3, -5, 0}},
-		"合作":   {[]int{6, 1, 3}, 1, [3]int{3, 3, 5}},
-		"学习":   {[]int{5, 4, 1, 2}, 1, [3]int{3, -1, 5}},
-		"工作":   {[]int{1, 4}, 1, [3]int{3, -1, 8}},
-		"放弃":   {[]int{7, 2, 5, 6, 1}, 2, [3]int{1, -3, -3}},
-		"狡辩":   {[]int{5, 0, 2}, 2, [3]int{-2, -2, -5}},
-		"怀疑":   {[]int{1, 3, 5, 4}, 2, [3]int{1, -3, 1}},
-		"自我质疑": {[]int{1, 7, 6, 4, 3}, 1, [3]int{3, 5, -1}},
-		"签订契约": {[]int{1, 4}, 1, [3]int{3, 2, 9}},
-		"许诺":   {[]int{1, 4, 6}, 2, [3]int{5, 5, 9}},
-		"跑路":   {[]int{3, 5, 2, 0}, 2, [3]int{3, 3, -5}},
-		"购买":   {[]int{7, 0, 4, 2}, 1, [3]int{1, 1, 1}},
-		"思考":   {[]int{5}, 1, [3]int{5, 0, 2}},
-		"分析":   {[]int{5, 4, 2, 3}, 2, [3]int{2, 0, 3}},
-		"创造":   {[]int{2, 7, 5, 4}, 2, [3]int{8, 1, 2}},
-		"做白日梦": {[]int{7, 2}, 1, [3]int{3, 3, -2}},
-		"运动":   {[]int{0, 1}, 1, [3]int{8, 1, 0}},
-		"狂奔":   {[]int{0}, 1, [3]int{8, 2, 0}},
-		"逃跑":   {[]int{0, 4, 3}, 2, [3]int{2, -1, 0}},
-		"沉思":   {[]int{3, 2, 5, 7}, 3, [3]int{5, 2, 3}},
-		"理性思考": {[]int{5, 4}, 2, [3]int{3, 1, 2}},
-		"逻辑思考": {[]int{5, 2}, 2, [3]int{3, 0, 2}},
-		"证明":   {[]int{4, 1, 5, 2}, 2, [3]int{3, 1, 3}},
-		"同化":   {[]int{6, 4, 5, 3}, 1, [3]int{3, 1, -1}},
-		"排挤":   {[]int{7, 6, 1, 3}, 2, [3]int{3, -8, -2}},
-		"吹捧":   {[]int{1, 6, 4}, 1, [3]int{5, 5, -8}},
-		"奉承":   {[]int{1, 6, 4}, 1, [3]int{5, 8, -9}},
-		"批判":   {[]int{4, 5, 3, 7, 1}, 2, [3]int{3, -5, 3}},
-		"启发":   {[]int{4, 5, 6, 3}, 2, [3]int{1, 1, 3}},
-		"信仰":   {[]int{3, 7, 6}, 2, [3]int{3, 1, 9}},
-		"苦中作乐": {[]int{2, 5, 7, 0}, 2, [3]int{5, -1, 0}},
-		"顿悟":   {[]int{3}, 3, [3]int{3, -1, 2}},
-		"迷思":   {[]int{5, 2}, 2, [3]int{1, 1, 1}},
-		"偷懒":   {[]int{0, 5, 2}, 1, [3]int{1, 0, -5}},
-		"不懂装懂": {[]int{1, 4, 6}, 1, [3]int{0, 0, -3}},
-		"变性":   {[]int{}, 3, [3]int{3, 0, 9}},
-		"内在探索": {[]int{3, 5, 7, 1}, 2, [3]int{1, 1, 3}},
-		"追求平等": {[]int{7, 6, 4, 5, 3}, 2, [3]int{1, 0, 9}},
-		"出柜":   {[]int{7, 4, 2, 3}, 3, [3]int{3, 5, 9}},
-		"解放天性": {[]int{2, 7, 0, 1}, 3, [3]int{5, 3, 0}},
-		"自闭":   {[]int{}, 2, [3]int{-3, -3, 0}},
-		"蛊惑":   {[]int{0, 5, 3, 2}, 1, [3]int{9, 8, -2}},
-		"放手":   {[]int{6, 5, 2}, 3, [3]int{2, -5, -1}},
-		"坚持":   {[]int{1, 4, 3}, 1, [3]int{1, 2, 2}},
-		"承认":   {[]int{4, 3, 5}, 1, [3]int{1, 2, 5}},
-		"献祭":   {[]int{3, 1, 6, 4}, 1, [3]int{3, 1, 9}},
-		"祭祀":   {[]int{1, 3, 6, 4}, 1, [3]int{1, 4, 5}},
-		"跳舞":   {[]int{0, 6, 3, 1}, 1, [3]int{5, 4, 1}},
-		"强化":   {[]int{1, 7}, 1, [3]int{3, 0, 3}},
-		"观察":   {[]int{1, 0}, 1, [3]int{1, 1, 1}},
-		"祈祷":   {[]int{3, 7}, 1, [3]int{0, 3, 2}},
-		"咆哮":   {[]int{7, 4, 1}, 1, [3]int{2, -8, -3}},
-		"表达情绪": {[]int{7, 1, 4}, 1, [3]int{1, 5, 2}},
-		"保护":   {[]int{0, 1, 7}, 1, [3]int{1, 5, 8}},
-		"养育":   {[]int{6, 7, 3}, 3, [3]int{5, 9, 9}},
-		"读":    {[]int{1, 5, 7, 3}, 2, [3]int{0, 0, 1}},
-		"涂鸦":   {[]int{7, 0, 2}, 1, [3]int{3, 2, 0}},
-		"蹦跳":   {[]int{0}, 1, [3]int{2, 1, 0}},
-		"绘画":   {[]int{0, 7, 2, 3, 4}, 2, [3]int{5, 5, 0}},
-		"作曲":   {[]int{1, 7, 0, 3, 5}, 2, [3]int{5, 5, 0}},
-		"漫步":   {[]int{0, 3}, 1, [3]int{0, 3, 0}},
-		"盯":    {[]int{7, 0, 3}, 1, [3]int{1, 0, 0}},
-		"翻":    {[]int{0, 2}, 1, [3]int{0, 0, 0}},
-		"整理":   {[]int{1, 4, 6}, 1, [3]int{0, 0, 2}},
-		"穿越":   {[]int{0, 3}, 2, [3]int{0, 0, 0}},
-		"洞穿":   {[]int{3, 5, 6}, 2, [3]int{3, 3, 0}},
-		"洗":    {[]int{0, 1, 4}, 1, [3]int{0, 1, 1}},
-		"系":    {[]int{0, 1, 2, 5, 4}, 1, [3]int{1, 2, 2}},
-		"折叠":   {[]int{1, 4}, 1, [3]int{1, 1, 1}},
-		"打磨":   {[]int{1, 0, 4, 3}, 2, [3]int{2, 1, 5}},
-		"接通":   {[]int{1, 6, 7, 2}, 1, [3]int{1, 6, 1}},
-		"联系":   {[]int{2, 7, 0}, 1, [3]int{1, 6, 1}},
-		"鼓励":   {[]int{6, 7, 1}, 1, [3]int{2, 6, 3}},
-		"打击":   {[]int{4, 1, 7}, 1, [3]int{-5, -9, 2}},
-		"点燃":   {[]int{0, 2, 3, 7, 4}, 2, [3]int{8, 5, 3}},
-		"欺骗":   {[]int{0, 6, 3, 4}, 2, [3]int{-9, -9, -9}},
-		"幻想":   {[]int{2, 7, 1}, 1, [3]int{9, 7, 0}},
-		"联想":   {[]int{2}, 1, [3]int{0, 1, 0}},
-		"回忆":   {[]int{1}, 1, [3]int{0, 5, 1}},
-		"挖掘":   {[]int{3, 4, 5, 2, 0}, 2, [3]int{3, 3, 3}},
-		"破坏":   {[]int{0, 4, 3, 1, 7}, 1, [3]int{6, 2, 0}},
-		"建构":   {[]int{5, 2, 4, 1}, 3, [3]int{0, 0, 0}},
-		"教导":   {[]int{4, 2, 5, 1}, 2, [3]int{5, 2, 9}},
-		"感染":   {[]int{6, 4, 0, 7}, 1, [3]int{5, 2, 0}},
-	}
-}()
-var CardSetNames []string = func() []string {
-	names := []string{}
-	for key := range CardSet {
-		names = append(names, key)
-	}
-	return names
-}()
-
-var KeywordSetNames []string = []string{
-	"Crush！", "一起吃饭", "吃饭", "酒逢知己千杯少", "同宿", "意外惊喜", "惊吓", "亲友的赞美", "吊桥效应", "灰头土脸", "偶遇", "撞击", "攻击", "打击", "音乐", "打架", "运动", "异地", "重逢", "游戏", "影剧", "书", "手机", "学习", "教学", "艺术", "游行", "舞会", "嘉年华", "出游", "散步", "坠落", "攀登", "相谈", "搭乘", "天空", "雨", "雪", "阴天", "晴天", "狂风", "台风", "妖风", "山脉", "巨石", "草原", "高原", "平原", "台地", "森林", "沙漠", "枕头", "水果", "蛇", "太阳", "月亮", "星星", "水流", "抚养小孩", "共同事业", "车", "马", "牛", "蛙", "羊", "鸡", "兔", "龙", "鼠", "虎", "狗", "猪", "拥挤", "同居", "逛街", "香水店", "杂货铺", "饭店", "药店", "购房", "购物", "河流", "海滩", "交通工具", "密室共处", "争吵", "视觉", "触觉", "嗅觉", "味觉", "听觉", "尴尬", "错过", "话不投机半句多", "惊吓", "欺骗", "逃避", "别离", "第三者", "言语暴力", "肢体暴力", "疾病", "死亡", "失忆", "失业", "晴朗", "高山", "神秘仪式", "占卜", "火锅", "魔鬼料理", "蝴蝶", "感冒", "厨房", "椅子", "雨季", "雾霾", "寒冷", "沙漠", "竹林", "蜜蜂", "鳄鱼", "头痛", "客厅", "窗帘", "雷雨", "炎热", "峡谷", "清新", "松树", "蚂蚁", "壁虎", "发烧", "车站", "书本", "凉爽", "闪光", "菊花", "池塘", "咳嗽", "电视", "大雾", "潮湿", "山峰", "纯洁", "桃", "莲", "星空", "雪山", "暖阳", "茉莉", "蝉鸣", "龙虾", "头晕", "饭馆", "灯笼", "多云", "寒露", "河流", "光辉", "玫瑰", "蚊子", "龟壳", "胃痛", "教室", "笔", "暴风雨", "温暖", "海洋", "优雅", "荷叶", "蜘蛛", "羽毛", "疲劳", "图书馆", "笔记本", "雪花", "凉风", "湖泊", "灵动", "菠萝", "蜥蜴", "骨折", "市场", "沙发", "晚霞", "热浪", "岛屿", "宁静", "葡萄", "蚂蟥", "扭伤", "长城", "星光", "冰霜", "暖炉", "芙蓉", "蝗虫", "鲫鱼", "失眠", "客房", "钟楼", "啤酒", "雾气", "露水", "河岸", "光环", "风车", "鹰", "龟", "心跳", "会议室", "电子书", "僧侣", "雷声", "辣", "海浪", "优秀", "沼泽", "蜈蚣", "蜥蜴", "疾病", "商店", "冰雹", "微风", "海湾", "泼水", "橙子", "蛇", "拉肚子", "饮料", "通信", "深渊", "晚霞", "热带", "岛屿", "安详", "柠檬", "蜗牛", "扭腰", "珠宝", "星系", "霜降", "暖气", "花瓣", "油炸", "海产", "眼花", "客栈", "钟声", "春天", "夏天", "秋天", "冬天", "晴空", "露珠", "流水", "光线", "花卉", "苍蝇", "枯萎", "心痛", "书架", "笔记", "紫外线", "闪电", "升温", "海岸", "优雅", "荷塘", "蜈蚣", "蟑螂", "疾病", "商店", "电脑", "青岛", "冰雹", "微风", "海湾", "活泼", "橙子", "蛇", "拉肚子", "猫咖", "书店", "旅馆", "花园", "图书馆", "餐厅", "游乐园", "转轮", "花房", "温室", "收藏品店", "历史博物馆", "动物园", "公园", "学校", "健身房", "车站", "时间隧道", "水族馆", "剑道馆", "天文馆", "糖果店", "古堡", "跳蚤市集", "古典音乐厅", "咖啡店", "工坊", "屋顶", "阳台", "比赛", "烧烤区", "溜冰场", "星空露台", "药房", "古董店", "剧场", "画廊", "市集", "秘密地点", "彩票站", "宠物店", "迷宫花园", "夜市美食街", "古着服装店", "剑道馆", "虫洞", "秘密仪式", "齿轮", "鬼打墙",
+// Continues with the remaining duration kept on pausing
+func (t *PeekableTimer) Resume() {
+	if !t.Paused {
+		return
+	}
+	t.Reset(t.Left)
 }
 
-////// Gameplay //////
+// Arms an inert (e.g. restored) timer to call `f` at its recorded expiry,
+// or on resuming if paused
+func (t *PeekableTimer) Arm(f func()) {
+	t.Func = f
+	if f != nil && !t.Paused {
+		t.Timer = time.AfterFunc(max(t.Remaining(), 0), f)
+	}
+}
+
+// Serialized as the absolute expiry (Unix timestamp in milliseconds), or if paused,
+// as an object holding the remaining duration; restored timers are inert until armed
+type peekableTimerPaused struct {
+	PausedLeft int64 `json:"paused_left"`
+}
+
+func (t PeekableTimer) MarshalJSON() ([]byte, error) {
+	if t.Paused {
+		return json.Marshal(peekableTimerPaused{PausedLeft: t.Left.Milliseconds()})
+	}
+	return json.Marshal(t.Expires.UnixMilli())
+}
+func (t *PeekableTimer) UnmarshalJSON(b []byte) error {
+	var paused peekableTimerPaused
+	if json.Unmarshal(b, &paused) == nil {
+		left := time.Duration(paused.PausedLeft) * time.Millisecond
+		*t = PeekableTimer{Expires: time.Now().Add(left), Paused: true, Left: left}
+		return nil
+	}
+	var expires int64
+	if err := json.Unmarshal(b, &expires); err != nil {
+		return err
+	}
+	*t = PeekableTimer{Expires: time.UnixMilli(expires)}
+	return nil
+}
 
-const TimeLimitAppointment = 30 * time.Second
-const TimeLimitCardSelection = 60 * time.Second
-const TimeLimitStorytelling = 180 * time.Second
-const TimeLimitStorytellingCont = 120 * time.Second
+////// Gameplay //////
 
 type GameplayPhaseStatusAssembly struct {
 }
@@ -274,6 +198,8 @@ type GameplayPhaseStatusGameplayPlayer struct {
 	ActionPoints int
 	Hand         []string
 	GrowthPoints int
+	// Remaining extra time, see `GameplayState.Extend`
+	TimeBank time.Duration
 }
 type GameplayPhaseStatusGameplay struct {
 	ActCount   int
@@ -296,14 +222,16 @@ type GameplayPhaseStatusGameplay struct {
 	TargetResult     int
 }
 
-func max[T interface{ int | uint64 | float64 }](x, y T) T {
+func max[T interface {
+	int | uint64 | float64 | time.Duration
+}](x, y T) T {
 	if x > y {
 		return x
 	} else {
 		return y
 	}
 }
-func fillRandomElements(elements []string, n int, pool []string) []string {
+func fillRandomElements(random *CloudRandom, elements []string, n int, pool []string) []string {
 	if elements == nil {
 		elements = []string{}
 	}
@@ -312,7 +240,7 @@ func fillRandomElements(elements []string, n int, pool []string) []string {
 		set[w] = struct{}{}
 	}
 	for len(elements) < n {
-		w := pool[CloudRandom(len(pool))]
+		w := pool[random.Int(len(pool))]
 		if _, ok := set[w]; !ok {
 			elements = append(elements, w)
 			set[w] = struct{}{}
@@ -320,21 +248,22 @@ func fillRandomElements(elements []string, n int, pool []string) []string {
 	}
 	return elements
 }
-func fillArena(arena []string, n int) []string {
-	return fillRandomElements(arena, n, KeywordSetNames)
+func fillArena(random *CloudRandom, content *GameContent, arena []string, n int) []string {
+	return fillRandomElements(random, arena, n, content.Keywords)
 }
-func fillCards(cards []string, n int) []string {
-	return fillRandomElements(cards, n, CardSetNames)
+func fillCards(random *CloudRandom, content *GameContent, cards []string, n int) []string {
+	return fillRandomElements(random, cards, n, content.CardNames)
 }
 
-func GameplayPhaseStatusGameplayNew(n int, holder int, f func()) GameplayPhaseStatusGameplay {
+func GameplayPhaseStatusGameplayNew(random *CloudRandom, content *GameContent, settings GameSettings, n int, holder int, f func()) GameplayPhaseStatusGameplay {
 	players := []GameplayPhaseStatusGameplayPlayer{}
 	for _ = range n {
 		players = append(players, GameplayPhaseStatusGameplayPlayer{
 			Relationship: make([][3]float32, n),
 			ActionPoints: 1,
-			Hand:         fillCards(nil, 5),
+			Hand:         fillCards(random, content, nil, settings.HandSize),
 			GrowthPoints: 0,
+			TimeBank:     settings.TimeBank.Duration(),
 		})
 	}
 
@@ -343,11 +272,11 @@ func GameplayPhaseStatusGameplayNew(n int, holder int, f func()) GameplayPhaseSt
 		RoundCount: 1,
 		MoveCount:  1,
 		Player:     players,
-		Arena:      fillArena(nil, max(n, 3)),
+		Arena:      fillArena(random, content, nil, max(n, settings.ArenaSize)),
 		Holder:     holder,
 		Step:       "selection",
 
-		Timer: NewPeekableTimerFunc(TimeLimitCardSelection, f),
+		Timer: NewPeekableTimerFunc(settings.TimeLimitCardSelection.Duration(), f),
 		Queue: []int{},
 
 		// Current action irrelevant
@@ -357,12 +286,54 @@ func GameplayPhaseStatusGameplayNew(n int, holder int, f func()) GameplayPhaseSt
 type GameplayPlayer struct {
 	User
 	Profile
+	// Confirmed in assembly phase before the game starts
+	Ready bool
+	// Strategy name for bots (see `BotStrategies`), empty for human players
+	Bot string
+	// Delegated players are played by the server as on timeouts, without waiting
+	Delegated bool
+	// Timers run out in a row, counting towards automatic delegation
+	MissedTimers int
 }
+
+// Number of timers a player may miss in a row before being delegated
+const GameplayDelegateAfterMisses = 2
+
 type GameplayState struct {
 	Players     []GameplayPlayer
 	PhaseStatus interface {
 		Repr(userId int) OrderedKeysMarshal
 	}
+
+	// Seed recorded at the start of the game, and the generator derived from it
+	Seed   uint32
+	Random *CloudRandom
+	// Cards and keywords in use, fixed at the start of the game
+	Content *GameContent
+	// Likewise fixed at the start
+	Settings GameSettings
+	// Commands accepted since the start, for reproducing the game
+	Actions []GameplayAction
+}
+
+// An accepted gameplay command. Given the players and the seed,
+// the list of these reproduces a game exactly
+type GameplayAction struct {
+	Type       string `json:"type"`
+	UserId     int    `json:"user_id"` // -1 denotes a timeout
+	HandIndex  int    `json:"hand_index,omitempty"`
+	ArenaIndex int    `json:"arena_index,omitempty"`
+	Target     int    `json:"target,omitempty"`
+}
+
+// Timers send signals to the room; without a channel (when replaying), timers are inert
+func timerSignal(roomSignalChannel chan interface{}, timerType string) func() {
+	if roomSignalChannel == nil {
+		return nil
+	}
+	return func() {
+		roomSignalChannel <- GameRoomSignalTimer{Type: timerType}
+	}
 }
 
 func (ps GameplayPhaseStatusAssembly) Repr(playerIndex int) OrderedKeysMarshal {
@@ -372,6 +343,7 @@ func (ps GameplayPhaseStatusAppointment) Repr(playerIndex int) OrderedKeysMarsha
 	return OrderedKeysMarshal{
 		{"holder", ps.Holder},
 		{"timer", json.Number(fmt.Sprintf("%.1f", ps.Timer.Remaining().Seconds()))},
+		{"deadline", ps.Timer.Deadline()},
 	}
 }
 func (ps GameplayPhaseStatusGameplay) Repr(playerIndex int) OrderedKeysMarshal {
@@ -379,15 +351,22 @@ func (ps GameplayPhaseStatusGameplay) Repr(playerIndex int) OrderedKeysMarshal {
 }
 func (ps GameplayPhaseStatusGameplay) ReprWithEvent(playerIndex int, event string, isTimeout bool) OrderedKeysMarshal {
 	actionTaken := (ps.Step == "storytelling_holder" || ps.Step == "storytelling_target")
-	return OrderedKeysMarshal{
+	entries := OrderedKeysMarshal{
 		{"event", event},
 		{"is_timeout", isTimeout},
 		{"act_count", ps.ActCount},
 		{"round_count", ps.RoundCount},
 		{"move_count", ps.MoveCount},
-		{"relationship", ps.Player[playerIndex].Relationship},
-		{"action_points", ps.Player[playerIndex].ActionPoints},
-		{"hand", ps.Player[playerIndex].Hand},
+	}
+	// Those not seated (spectators) see only the public part
+	if playerIndex != -1 {
+		entries = append(entries,
+			OrderedKeysEntry{"relationship", ps.Player[playerIndex].Relationship},
+			OrderedKeysEntry{"action_points", ps.Player[playerIndex].ActionPoints},
+			OrderedKeysEntry{"hand", ps.Player[playerIndex].Hand},
+		)
+	}
+	return append(entries, OrderedKeysMarshal{
 		{"arena", ps.Arena},
 		{"holder", ps.Holder},
 		{"step", ps.Step},
@@ -399,20 +378,52 @@ func (ps GameplayPhaseStatusGameplay) ReprWithEvent(playerIndex int, event strin
 		{"target_difficulty", validOrNil(actionTaken && ps.Target != -1, ps.TargetDifficulty)},
 		{"target_result", validOrNil(actionTaken && ps.Target != -1, ps.TargetResult)},
 		{"timer", json.Number(fmt.Sprintf("%.1f", ps.Timer.Remaining().Seconds()))},
+		{"deadline", ps.Timer.Deadline()},
 		{"queue", ps.Queue},
+		{"time_bank", ps.TimeBankRepr()},
+	}...)
+}
+
+func (ps GameplayPhaseStatusGameplay) TimeBankRepr() []json.Number {
+	banks := []json.Number{}
+	for _, p := range ps.Player {
+		banks = append(banks, json.Number(fmt.Sprintf("%.1f", p.TimeBank.Seconds())))
 	}
+	return banks
 }
 
 // The `GameRoom` reference is for additionally adding unseated players in assembly phase
+// (nil when replaying a recorded game)
 func (s GameplayState) PlayerReprs(r *GameRoom) []OrderedKeysMarshal {
+	_, isAssembly := s.PhaseStatus.(GameplayPhaseStatusAssembly)
+
 	playerReprs := []OrderedKeysMarshal{}
 	for _, p := range s.Players {
-		playerReprs = append(playerReprs, p.Profile.Repr())
+		var repr OrderedKeysMarshal
+		if p.IsBot() {
+			repr = p.BotRepr()
+		} else {
+			repr = p.Profile.Repr()
+		}
+		if isAssembly {
+			repr = append(repr, OrderedKeysEntry{"ready", p.Ready})
+		}
+		if r != nil {
+			online, lastSeen := r.Presence(p)
+			repr = append(repr,
+				OrderedKeysEntry{"online", online},
+				OrderedKeysEntry{"last_seen", lastSeen},
+			)
+		}
+		playerReprs = append(playerReprs, repr)
 	}
 
 	// Unseated players in assembly phase
-	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+	if isAssembly && r != nil {
 		for userId, conn := range r.Conns {
+			if conn.Spectator {
+				continue
+			}
 			seated := false
 			for _, p := range s.Players {
 				if p.User.Id == userId {
@@ -424,6 +435,9 @@ func (s GameplayState) PlayerReprs(r *GameRoom) []OrderedKeysMarshal {
 				playerReprs = append(playerReprs, OrderedKeysMarshal{
 					{"id", nil},
 					{"creator", conn.User.Repr()},
+					{"ready", false},
+					{"online", true},
+					{"last_seen", nil},
 				})
 			}
 		}
@@ -431,39 +445,42 @@ func (s GameplayState) PlayerReprs(r *GameRoom) []OrderedKeysMarshal {
 
 	return playerReprs
 }
+func (s GameplayState) PhaseName() string {
+	switch s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAssembly:
+		return "assembly"
+	case GameplayPhaseStatusAppointment:
+		return "appointment"
+	case GameplayPhaseStatusGameplay:
+		return "gameplay"
+	}
+	return ""
+}
+
 func (s GameplayState) Repr(r *GameRoom, userId int) OrderedKeysMarshal {
 	// Players
 	playerReprs := s.PlayerReprs(r)
 	playerIndex := s.PlayerIndex(userId)
 
 	// Phase
-	var phaseName string
-	var statusRepr OrderedKeysMarshal
-	switch ps := s.PhaseStatus.(type) {
-	case GameplayPhaseStatusAssembly:
-		phaseName = "assembly"
-		statusRepr = ps.Repr(playerIndex)
-
-	case GameplayPhaseStatusAppointment:
-		phaseName = "appointment"
-		statusRepr = ps.Repr(playerIndex)
-
-	case GameplayPhaseStatusGameplay:
-		phaseName = "gameplay"
-		statusRepr = ps.Repr(playerIndex)
-	}
+	phaseName := s.PhaseName()
+	statusRepr := s.PhaseStatus.Repr(playerIndex)
 
 	entries := OrderedKeysMarshal{
 		{"players", playerReprs},
 		{"phase", phaseName},
 	}
 	if statusRepr != nil {
+		statusRepr = append(statusRepr, OrderedKeysEntry{"delegated", s.DelegatedSeats()})
+		if r != nil {
+			statusRepr = append(statusRepr, OrderedKeysEntry{"online", s.OnlineSeats(r)})
+		}
 		entries = append(entries, OrderedKeysEntry{phaseName + "_status", statusRepr})
 	}
 	return entries
 }
 
-func (s *GameplayState) Seat(user User, profile Profile) (string, string) {
+func (s *GameplayState) Seat(user User, profile Profile, maxPlayers int) (string, string) {
 	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); !ok {
 		return "Not in assembly phase", ""
 	}
@@ -473,6 +490,9 @@ func (s *GameplayState) Seat(user User, profile Profile) (string, string) {
 			return "Already seated", ""
 		}
 	}
+	if len(s.Players) >= maxPlayers {
+		return "No vacant seat", ""
+	}
 	s.Players = append(s.Players, GameplayPlayer{User: user, Profile: profile})
 	logContent := fmt.Sprintf("玩家【%s】坐下", user.Nickname)
 	return "", logContent
@@ -493,16 +513,76 @@ func (s *GameplayState) WithdrawSeat(userId int) (string, string) {
 }
 
 // (error, log content)
-func (s *GameplayState) Start(roomSignalChannel chan interface{}) (string, string) {
+func (s *GameplayState) SetReady(userId int, ready bool) (string, string) {
+	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); !ok {
+		return "Not in assembly phase", ""
+	}
+	for i, p := range s.Players {
+		if p.User.Id == userId {
+			if p.Ready == ready {
+				return "", ""
+			}
+			s.Players[i].Ready = ready
+			if ready {
+				return "", fmt.Sprintf("玩家【%s】已准备", p.User.Nickname)
+			} else {
+				return "", fmt.Sprintf("玩家【%s】取消准备", p.User.Nickname)
+			}
+		}
+	}
+	return "Not seated", ""
+}
+
+// Hands a seat over to another player in the middle of a game. The seat keeps
+// its hand, relationships and growth; delegation does not carry over
+// (error, log content)
+func (s *GameplayState) Substitute(seat int, user User, profile Profile) (string, string) {
+	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+		return "Game not started", ""
+	}
+	if seat < 0 || seat >= len(s.Players) {
+		return "`seat` out of range", ""
+	}
+	if s.PlayerIndex(user.Id) != -1 {
+		return "Already in game", ""
+	}
+	prev := s.Players[seat]
+	s.Players[seat] = GameplayPlayer{User: user, Profile: profile}
+	logContent := fmt.Sprintf("玩家【%s】接替玩家【%s】的座位", user.Nickname, prev.User.Nickname)
+	return "", logContent
+}
+
+// (error, log content)
+func (s *GameplayState) Start(roomSignalChannel chan interface{}, settings GameSettings) (string, string) {
+	return s.StartWithSeed(roomSignalChannel, CurrentContent(), settings, CloudRandomSeed())
+}
+
+func (s *GameplayState) StartWithSeed(roomSignalChannel chan interface{}, content *GameContent, settings GameSettings, seed uint32) (string, string) {
 	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); !ok {
 		return "Not in assembly phase", ""
 	}
+	// Each player needs a distinct keyword in the arena
+	if len(s.Players) > len(content.Keywords) {
+		return "Too many players", ""
+	}
+	// Hands and the arena hold distinct entries
+	if settings.ArenaSize > len(content.Keywords) {
+		return "Arena size exceeds the number of keywords", ""
+	}
+	if settings.HandSize > len(content.CardNames) {
+		return "Hand size exceeds the number of cards", ""
+	}
+	s.Content = content
+	s.Settings = settings
+	s.Seed = seed
+	s.Random = NewCloudRandom(seed)
+	s.Actions = []GameplayAction{}
+
 	st := GameplayPhaseStatusAppointment{
-		Holder: CloudRandom(len(s.Players)),
+		Holder: s.Random.Int(len(s.Players)),
 		Count:  0,
-		Timer: NewPeekableTimerFunc(TimeLimitAppointment, func() {
-			roomSignalChannel <- GameRoomSignalTimer{Type: "appointment"}
-		}),
+		Timer: NewPeekableTimerFunc(settings.TimeLimitAppointment.Duration(),
+			timerSignal(roomSignalChannel, "appointment")),
 	}
 	s.PhaseStatus = st
 
@@ -516,6 +596,73 @@ func (s *GameplayState) Start(roomSignalChannel chan interface{}) (string, strin
 func (s *GameplayState) Reset() {
 	s.Players = []GameplayPlayer{}
 	s.PhaseStatus = GameplayPhaseStatusAssembly{}
+	s.Seed = 0
+	s.Random = nil
+	s.Content = nil
+	s.Settings = GameSettings{}
+	s.Actions = nil
+}
+
+// Stops the pending timer, for a room closing in the middle of a game
+func (s *GameplayState) StopTimers() {
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		st.Timer.Stop()
+	case GameplayPhaseStatusGameplay:
+		st.Timer.Stop()
+	}
+}
+
+// A copy of the timer of the current phase, if there is one
+func (s GameplayState) PhaseTimer() (PeekableTimer, bool) {
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		return st.Timer, true
+	case GameplayPhaseStatusGameplay:
+		return st.Timer, true
+	}
+	return PeekableTimer{}, false
+}
+
+// Whether the timer of the current phase has run out. A timer signal may be
+// stale, as a move made just as it fired has reset the timer for the next step
+func (s GameplayState) TimerExpired() bool {
+	t, ok := s.PhaseTimer()
+	return ok && !t.Paused && t.Remaining() <= 0
+}
+
+func (s GameplayState) Paused() bool {
+	t, _ := s.PhaseTimer()
+	return t.Paused
+}
+
+// Freezes or continues the timer of the current phase; returns the error message
+func (s *GameplayState) SetPaused(paused bool) string {
+	if s.Paused() == paused {
+		if paused {
+			return "Already paused"
+		} else {
+			return "Not paused"
+		}
+	}
+	update := func(t *PeekableTimer) {
+		if paused {
+			t.Pause()
+		} else {
+			t.Resume()
+		}
+	}
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		update(&st.Timer)
+		s.PhaseStatus = st
+	case GameplayPhaseStatusGameplay:
+		update(&st.Timer)
+		s.PhaseStatus = st
+	default:
+		return "Game not started"
+	}
+	return ""
 }
 
 func (s GameplayState) PlayerIndex(userId int) int {
@@ -535,6 +682,98 @@ func (s GameplayState) PlayerIndexNullable(userId int) interface{} {
 	}
 }
 
+// Whether the last act is over, as on the storytelling that ends the game
+func (s GameplayState) Ended() bool {
+	st, ok := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	return ok && st.ActCount > len(s.Settings.ActRounds)
+}
+
+// The seat whose move is awaited (the one a timeout acts for); -1 if none
+func (s GameplayState) ActingSeat() int {
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		return st.Holder
+	case GameplayPhaseStatusGameplay:
+		if st.Step == "storytelling_target" {
+			return st.Target
+		}
+		return st.Holder
+	}
+	return -1
+}
+
+func (s GameplayState) DelegatedSeats() []int {
+	seats := []int{}
+	for i, p := range s.Players {
+		if p.Delegated {
+			seats = append(seats, i)
+		}
+	}
+	return seats
+}
+
+// Gameplay status as in messages, including delegation and presence that live outside the phase
+func (s GameplayState) GameplayStatusRepr(r *GameRoom, playerIndex int, event string, isTimeout bool) OrderedKeysMarshal {
+	st := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	return append(st.ReprWithEvent(playerIndex, event, isTimeout),
+		OrderedKeysEntry{"delegated", s.DelegatedSeats()},
+		OrderedKeysEntry{"online", s.OnlineSeats(r)})
+}
+
+// Whether each seated player is connected, as in the player list
+func (s GameplayState) OnlineSeats(r *GameRoom) []bool {
+	online := []bool{}
+	for _, p := range s.Players {
+		o, _ := r.Presence(p)
+		online = append(online, o)
+	}
+	return online
+}
+
+// (error, log content)
+func (s *GameplayState) SetDelegated(userId int, delegated bool, isTimeout bool) (string, string) {
+	if _, ok := s.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+		return "Game not started", ""
+	}
+	playerIndex := s.PlayerIndex(userId)
+	if playerIndex == -1 {
+		return "Not in game", ""
+	}
+	p := &s.Players[playerIndex]
+	if p.IsBot() {
+		return "Bots cannot be delegated", ""
+	}
+	p.MissedTimers = 0
+	if p.Delegated == delegated {
+		return "", ""
+	}
+	p.Delegated = delegated
+	if isTimeout {
+		return "", fmt.Sprintf("玩家【%s】连续超时，已自动托管", p.User.Nickname)
+	} else if delegated {
+		return "", fmt.Sprintf("玩家【%s】开启托管", p.User.Nickname)
+	} else {
+		return "", fmt.Sprintf("玩家【%s】取消托管", p.User.Nickname)
+	}
+}
+
+// Counts a timeout against the player; returns whether they are due to be delegated
+func (s *GameplayState) MissTimer(userId int) bool {
+	playerIndex := s.PlayerIndex(userId)
+	if playerIndex == -1 || s.Players[playerIndex].Delegated {
+		return false
+	}
+	s.Players[playerIndex].MissedTimers++
+	return s.Players[playerIndex].MissedTimers >= GameplayDelegateAfterMisses
+}
+
+// Called when the player moves by themselves
+func (s *GameplayState) ClearMissedTimers(userId int) {
+	if playerIndex := s.PlayerIndex(userId); playerIndex != -1 {
+		s.Players[playerIndex].MissedTimers = 0
+	}
+}
+
 func ifTimeout(isTimeout bool) string {
 	if isTimeout {
 		return "（超时自动托管）"
@@ -559,9 +798,13 @@ func (s *GameplayState) AppointmentAcceptOrPass(userId int, accept bool, roomSig
 		return -1, -1, false, "Not move holder", ""
 	}
 
-	f := func() {
-		roomSignalChannel <- GameRoomSignalTimer{Type: "gameplay"}
+	f := timerSignal(roomSignalChannel, "gameplay")
+
+	actionType := "appointment_pass"
+	if accept {
+		actionType = "appointment_accept"
 	}
+	s.Actions = append(s.Actions, GameplayAction{Type: actionType, UserId: userId})
 
 	if !accept {
 		st.Count++
@@ -569,7 +812,7 @@ func (s *GameplayState) AppointmentAcceptOrPass(userId int, accept bool, roomSig
 			// Continue
 			prev := st.Holder
 			st.Holder = (st.Holder + 1) % len(s.Players)
-			st.Timer.Reset(TimeLimitAppointment)
+			st.Timer.Reset(s.Settings.TimeLimitAppointment.Duration())
 			s.PhaseStatus = st
 			logContent := fmt.Sprintf(
 				"%s玩家【%s】跳过指派，轮到玩家【%s】",
@@ -581,8 +824,8 @@ func (s *GameplayState) AppointmentAcceptOrPass(userId int, accept bool, roomSig
 		} else {
 			// Random appointment
 			st.Timer.Stop()
-			luckyDog := CloudRandom(len(s.Players))
-			s.PhaseStatus = GameplayPhaseStatusGameplayNew(len(s.Players), luckyDog, f)
+			luckyDog := s.Random.Int(len(s.Players))
+			s.PhaseStatus = GameplayPhaseStatusGameplayNew(s.Random, s.Content, s.Settings, len(s.Players), luckyDog, f)
 			logContent := fmt.Sprintf(
 				"%s玩家【%s】跳过指派。随机抽取玩家【%s】开始游戏",
 				ifTimeout(userId == -1),
@@ -593,7 +836,7 @@ func (s *GameplayState) AppointmentAcceptOrPass(userId int, accept bool, roomSig
 		}
 	} else {
 		st.Timer.Stop()
-		s.PhaseStatus = GameplayPhaseStatusGameplayNew(len(s.Players), st.Holder, f)
+		s.PhaseStatus = GameplayPhaseStatusGameplayNew(s.Random, s.Content, s.Settings, len(s.Players), st.Holder, f)
 		logContent := fmt.Sprintf(
 			"玩家【%s】接受指派，作为起始玩家开始游戏",
 			s.Players[st.Holder].User.Nickname,
@@ -616,10 +859,17 @@ func (s *GameplayState) ActionCheck(userId int, handIndex int, arenaIndex int, t
 	}
 
 	playerIndex := st.Holder
+	action := GameplayAction{
+		Type:       "action",
+		UserId:     userId,
+		HandIndex:  handIndex,
+		ArenaIndex: arenaIndex,
+		Target:     target,
+	}
 
 	if userId == -1 {
-		handIndex = CloudRandom(len(st.Player[playerIndex].Hand))
-		arenaIndex = CloudRandom(len(st.Arena))
+		handIndex = s.Random.Int(len(st.Player[playerIndex].Hand))
+		arenaIndex = s.Random.Int(len(st.Arena))
 	}
 
 	if handIndex < 0 || handIndex >= len(st.Player[playerIndex].Hand) {
@@ -635,16 +885,18 @@ func (s *GameplayState) ActionCheck(userId int, handIndex int, arenaIndex int, t
 		target = -1
 	}
 
+	s.Actions = append(s.Actions, action)
+
 	st.Step = "storytelling_holder"
 	st.Action = st.Player[playerIndex].Hand[handIndex]
 	st.Keyword = arenaIndex
 	st.Target = target
-	st.HolderDifficulty = CloudRandom(100)
+	st.HolderDifficulty = s.Random.Int(100)
 
 	keyword := st.Arena[st.Keyword]
 
 	// Check
-	card := CardSet[st.Action]
+	card := s.Content.Cards[st.Action]
 	checkResult := func(difficulty int, stats [8]int) int {
 		if difficulty <= 5 {
 			return 2
@@ -688,7 +940,7 @@ func (s *GameplayState) ActionCheck(userId int, handIndex int, arenaIndex int, t
 	}
 
 	if target != -1 {
-		difficulty := CloudRandom(100)
+		difficulty := s.Random.Int(100)
 		st.TargetDifficulty = difficulty
 		switch st.HolderResult {
 		case 2:
@@ -716,7 +968,7 @@ func (s *GameplayState) ActionCheck(userId int, handIndex int, arenaIndex int, t
 	}
 	st.Player[playerIndex].GrowthPoints += growth
 
-	st.Timer.Reset(TimeLimitStorytelling)
+	st.Timer.Reset(s.Settings.TimeLimitStorytelling.Duration())
 
 	// Remove card from hand
 	st.Player[playerIndex].Hand = append(
@@ -788,12 +1040,14 @@ func (s *GameplayState) StorytellingEnd(userId int) (bool, bool, string, string)
 		return false, false, "Not storyteller", ""
 	}
 
+	s.Actions = append(s.Actions, GameplayAction{Type: "storytelling_end", UserId: userId})
+
 	isNewMove := false
 	isGameEnd := false
 	if nextStoryteller != -1 {
 		st.Step = "storytelling_target"
 		isNewMove = false
-		st.Timer.Reset(TimeLimitStorytellingCont)
+		st.Timer.Reset(s.Settings.TimeLimitStorytellingCont.Duration())
 	} else {
 		st.Step = "selection"
 		isNewMove = true
@@ -804,7 +1058,7 @@ func (s *GameplayState) StorytellingEnd(userId int) (bool, bool, string, string)
 			st.Arena[st.Keyword+1:]...,
 		)
 		// Replenish hand
-		st.Player[st.Holder].Hand = fillCards(st.Player[st.Holder].Hand, 5)
+		st.Player[st.Holder].Hand = fillCards(s.Random, s.Content, st.Player[st.Holder].Hand, s.Settings.HandSize)
 		// Next player
 		if len(st.Queue) > 0 {
 			st.Holder = st.Queue[0]
@@ -818,31 +1072,31 @@ func (s *GameplayState) StorytellingEnd(userId int) (bool, bool, string, string)
 				}
 			}
 			if len(nonZero) > 0 {
-				st.Holder = nonZero[CloudRandom(len(nonZero))]
+				st.Holder = nonZero[s.Random.Int(len(nonZero))]
 			} else {
 				// New round!
 				st.RoundCount += 1
 				st.MoveCount = 1
-				actRounds := []int{1, 2, 1, 1}
+				actRounds := s.Settings.ActRounds
 				if st.RoundCount > actRounds[st.ActCount-1] {
 					st.ActCount += 1
 					st.RoundCount = 1
-					if st.ActCount > 4 {
+					if st.ActCount > len(actRounds) {
 						// Game end!
 						isGameEnd = true
 					}
 				}
 				// Replenish arena
-				st.Arena = fillArena(st.Arena, max(len(s.Players), 3))
+				st.Arena = fillArena(s.Random, s.Content, st.Arena, max(len(s.Players), s.Settings.ArenaSize))
 				// Replenish action points
 				for i, _ := range st.Player {
 					st.Player[i].ActionPoints = 1
 				}
 				// Random player
-				st.Holder = CloudRandom(len(s.Players))
+				st.Holder = s.Random.Int(len(s.Players))
 			}
 		}
-		st.Timer.Reset(TimeLimitCardSelection)
+		st.Timer.Reset(s.Settings.TimeLimitCardSelection.Duration())
 	}
 
 	s.PhaseStatus = st
@@ -867,7 +1121,6 @@ func (s *GameplayState) StorytellingEnd(userId int) (bool, bool, string, string)
 			"%s主动方【%s】完成讲述\n轮到被动方【%s】继续讲述",
 			ifTimeout(userId == -1),
 			s.Players[storyteller].User.Nickname,
-			s.Players[storyteller].User.Nickname,
 			s.Players[nextStoryteller].User.Nickname,
 		)
 	}
@@ -899,104 +1152,702 @@ func (s *GameplayState) Queue(userId int) string {
 	st.Queue = append(st.Queue, playerIndex)
 	s.PhaseStatus = st
 
+	s.Actions = append(s.Actions, GameplayAction{Type: "queue", UserId: userId})
+
 	return ""
 }
 
-////// Room //////
+// Amount drawn from the time bank at a time
+const GameplayTimeBankStep = 30 * time.Second
 
-type GameRoomLog struct {
-	Id        int
-	Timestamp int64
-	Content   string
+// Adds time from the bank of the awaited player to the current step.
+// A `userId` of -1 means on behalf of the awaited player, as their timer runs out
+// (error, log content)
+func (s *GameplayState) Extend(userId int) (string, string) {
+	st, ok := s.PhaseStatus.(GameplayPhaseStatusGameplay)
+	if !ok {
+		return "Not in gameplay phase", ""
+	}
+	seat := s.ActingSeat()
+	if userId != -1 && s.Players[seat].User.Id != userId {
+		return "Not move holder", ""
+	}
+	bank := st.Player[seat].TimeBank
+	if bank <= 0 {
+		return "No time left in bank", ""
+	}
+	amount := min(bank, GameplayTimeBankStep)
+	st.Player[seat].TimeBank -= amount
+	st.Timer.Reset(max(st.Timer.Remaining(), 0) + amount)
+	s.PhaseStatus = st
+
+	s.Actions = append(s.Actions, GameplayAction{Type: "extend", UserId: userId})
+
+	how := "使用"
+	if userId == -1 {
+		how = "超时，自动使用"
+	}
+	logContent := fmt.Sprintf("玩家【%s】%s时间储备，延长 %d 秒（剩余 %d 秒）",
+		s.Players[seat].User.Nickname, how,
+		int(amount.Seconds()), int(st.Player[seat].TimeBank.Seconds()))
+	return "", logContent
 }
 
-type GameRoom struct {
-	Room
-	Closed    bool
-	Conns     map[int]WebSocketConn
-	InChannel chan GameRoomInMessage
-	Signal    chan interface{}
-	Gameplay  GameplayState
-	Log       []GameRoomLog
-	Mutex     *sync.RWMutex
+// Re-applies a recorded command; returns the error message
+func (s *GameplayState) Apply(action GameplayAction, roomSignalChannel chan interface{}) string {
+	switch action.Type {
+	case "appointment_accept", "appointment_pass":
+		_, _, _, err, _ := s.AppointmentAcceptOrPass(action.UserId,
+			action.Type == "appointment_accept", roomSignalChannel)
+		return err
+	case "action":
+		err, _ := s.ActionCheck(action.UserId, action.HandIndex, action.ArenaIndex, action.Target)
+		return err
+	case "storytelling_end":
+		_, _, err, _ := s.StorytellingEnd(action.UserId)
+		return err
+	case "queue":
+		return s.Queue(action.UserId)
+	case "extend":
+		err, _ := s.Extend(action.UserId)
+		return err
+	}
+	return "Unknown action type"
 }
 
-var GameRoomMapMutex = &sync.Mutex{}
-var GameRoomMap = make(map[int]*GameRoom)
+// Payloads of recorded game events other than commands
+type GameplayPlayerRecord struct {
+	UserId   int     `json:"user_id"`
+	Nickname string  `json:"nickname"`
+	Profile  Profile `json:"profile"`
+	Bot      string  `json:"bot,omitempty"`
+}
+type GameplayStartRecord struct {
+	Seed           uint32        `json:"seed"`
+	ContentVersion int           `json:"content_version"`
+	Settings       *GameSettings `json:"settings,omitempty"` // nil for games before settings existed
+}
 
-func GameRoomFind(roomId int) *GameRoom {
-	return GameRoomMap[roomId]
+type GameplaySubstituteRecord struct {
+	Seat   int                  `json:"seat"`
+	Player GameplayPlayerRecord `json:"player"`
 }
 
-func (r *GameRoom) Join(user User, channel chan interface{}) int {
-	r.Mutex.Lock()
-	playerIndex := len(r.Conns)
-	r.Conns[user.Id] = WebSocketConn{User: user, OutChannel: channel}
-	r.Mutex.Unlock()
-	r.Signal <- GameRoomSignalNewConn{
-		UserId: user.Id,
+func (p GameplayPlayer) Record() GameplayPlayerRecord {
+	return GameplayPlayerRecord{
+		UserId:   p.User.Id,
+		Nickname: p.User.Nickname,
+		Profile:  p.Profile,
+		Bot:      p.Bot,
 	}
-	return playerIndex
 }
-
-func (r *GameRoom) Lost(userId int, channel chan interface{}) {
-	r.Mutex.Lock()
-	closed := r.Closed
-	r.Mutex.Unlock()
-	if !closed {
-		r.Signal <- GameRoomSignalLostConn{
-			UserId:  userId,
-			Channel: channel,
-		}
+func (p GameplayPlayerRecord) Player() GameplayPlayer {
+	return GameplayPlayer{
+		User:    User{Id: p.UserId, Nickname: p.Nickname},
+		Profile: p.Profile,
+		Bot:     p.Bot,
 	}
 }
 
-// Assumes the mutex is held (RLock'ed)
-func (r *GameRoom) StateMessage(userId int) OrderedKeysMarshal {
-	entries := OrderedKeysMarshal{
-		{"type", "room_state"},
-		{"room", r.Room.Repr()},
-		{"my_index", r.Gameplay.PlayerIndexNullable(userId)},
-	}
-	entries = append(entries, r.Gameplay.Repr(r, userId)...)
-	return entries
+// Everything needed to bring a game back after a restart
+type GameplaySnapshot struct {
+	Players     []GameplayPlayerRecord          `json:"players"`
+	Phase       string                          `json:"phase"`
+	Appointment *GameplayPhaseStatusAppointment `json:"appointment,omitempty"`
+	Gameplay    *GameplayPhaseStatusGameplay    `json:"gameplay,omitempty"`
+	Seed        uint32                          `json:"seed"`
+	Random      *CloudRandom                    `json:"random"`
+	Content     int                             `json:"content_version,omitempty"`
+	Settings    *GameSettings                   `json:"settings,omitempty"`
+	Actions     []GameplayAction                `json:"actions"`
+	// User IDs of players ready in assembly phase
+	Ready []int `json:"ready,omitempty"`
+	// User IDs of delegated players (counts of missed timers start over)
+	Delegated []int `json:"delegated,omitempty"`
 }
 
-func (r *GameRoom) LogMessage(history int) OrderedKeysMarshal {
-	logsReprs := []OrderedKeysMarshal{}
-	logs := r.Log
-	if history > 0 {
-		logs = r.Log[len(r.Log)-history:]
+func (s GameplayState) Snapshot() GameplaySnapshot {
+	snapshot := GameplaySnapshot{
+		Players: []GameplayPlayerRecord{},
+		Seed:    s.Seed,
+		Random:  s.Random,
+		Actions: s.Actions,
 	}
-	for _, entry := range logs {
-		logsReprs = append(logsReprs, OrderedKeysMarshal{
-			{"id", entry.Id},
-			{"timestamp", entry.Timestamp},
-			{"content", entry.Content},
-		})
+	if s.Content != nil {
+		snapshot.Content = s.Content.Version
+		snapshot.Settings = &s.Settings
 	}
-	return OrderedKeysMarshal{
-		{"type", "log"},
-		{"log", logsReprs},
+	for _, p := range s.Players {
+		snapshot.Players = append(snapshot.Players, p.Record())
+		if p.Ready {
+			snapshot.Ready = append(snapshot.Ready, p.User.Id)
+		}
+		if p.Delegated {
+			snapshot.Delegated = append(snapshot.Delegated, p.User.Id)
+		}
 	}
+	snapshot.Phase = s.PhaseName()
+	switch ps := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		snapshot.Appointment = &ps
+	case GameplayPhaseStatusGameplay:
+		snapshot.Gameplay = &ps
+	}
+	return snapshot
 }
 
-// All broadcast subroutines assume the mutex is held (RLock'ed)
-
-func (r *GameRoom) BroadcastStart() {
-	for userId, conn := range r.Conns {
-		conn.OutChannel <- OrderedKeysMarshal{
+// Timers are re-armed to their original deadlines, firing at once if already past
+func (s *GameplayState) Restore(snapshot GameplaySnapshot, roomSignalChannel chan interface{}) {
+	s.Players = []GameplayPlayer{}
+	for _, p := range snapshot.Players {
+		player := p.Player()
+		for _, userId := range snapshot.Ready {
+			if userId == p.UserId {
+				player.Ready = true
+			}
+		}
+		for _, userId := range snapshot.Delegated {
+			if userId == p.UserId {
+				player.Delegated = true
+			}
+		}
+		s.Players = append(s.Players, player)
+	}
+	s.Seed = snapshot.Seed
+	s.Random = snapshot.Random
+	s.Actions = snapshot.Actions
+	if snapshot.Phase != "assembly" {
+		s.Content = ContentByVersion(snapshot.Content)
+		if s.Content == nil {
+			s.Content = CurrentContent()
+		}
+		s.Settings = DefaultGameSettings()
+		if snapshot.Settings != nil {
+			s.Settings = *snapshot.Settings
+		}
+	}
+	switch snapshot.Phase {
+	case "appointment":
+		s.PhaseStatus = *snapshot.Appointment
+	case "gameplay":
+		s.PhaseStatus = *snapshot.Gameplay
+	default:
+		s.PhaseStatus = GameplayPhaseStatusAssembly{}
+	}
+	s.ArmTimers(roomSignalChannel)
+}
+
+// Arms the inert timer of a restored or replayed game
+func (s *GameplayState) ArmTimers(roomSignalChannel chan interface{}) {
+	switch st := s.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		st.Timer.Arm(timerSignal(roomSignalChannel, "appointment"))
+		s.PhaseStatus = st
+	case GameplayPhaseStatusGameplay:
+		st.Timer.Arm(timerSignal(roomSignalChannel, "gameplay"))
+		s.PhaseStatus = st
+	}
+}
+
+// Reproduces the state after a prefix of a recorded event stream
+func GameplayReplayEvents(events []GameEvent) (GameplayState, string) {
+	s := GameplayState{
+		Players:     []GameplayPlayer{},
+		PhaseStatus: GameplayPhaseStatusAssembly{},
+	}
+	for _, event := range events {
+		var err string
+		switch event.Type {
+		case "seat":
+			var record GameplayPlayerRecord
+			if json.Unmarshal([]byte(event.Payload), &record) != nil {
+				err = "Malformed payload"
+			} else {
+				s.Players = append(s.Players, record.Player())
+			}
+		case "substitute":
+			var record GameplaySubstituteRecord
+			if json.Unmarshal([]byte(event.Payload), &record) != nil {
+				err = "Malformed payload"
+			} else {
+				player := record.Player.Player()
+				err, _ = s.Substitute(record.Seat, player.User, player.Profile)
+			}
+		case "start":
+			var record GameplayStartRecord
+			if json.Unmarshal([]byte(event.Payload), &record) != nil {
+				err = "Malformed payload"
+			} else {
+				// Games recorded before content was versioned use the current one
+				content := CurrentContent()
+				if record.ContentVersion != 0 {
+					content = ContentByVersion(record.ContentVersion)
+				}
+				settings := DefaultGameSettings()
+				if record.Settings != nil {
+					settings = *record.Settings
+				}
+				if content == nil {
+					err = fmt.Sprintf("Unknown content version %d", record.ContentVersion)
+				} else {
+					err, _ = s.StartWithSeed(nil, content, settings, record.Seed)
+				}
+			}
+		default:
+			var action GameplayAction
+			if json.Unmarshal([]byte(event.Payload), &action) != nil {
+				err = "Malformed payload"
+			} else {
+				err = s.Apply(action, nil)
+			}
+		}
+		if err != "" {
+			return s, fmt.Sprintf("Event %d (%s): %s", event.Index, event.Type, err)
+		}
+	}
+	return s, ""
+}
+
+////// Room //////
+
+type GameRoomLog struct {
+	Id        int
+	Timestamp int64
+	Content   string
+}
+
+// Number of latest log entries kept in memory; the full log is in the database
+const GameRoomLogRecent = 5
+
+func (l GameRoomLog) Repr() OrderedKeysMarshal {
+	return OrderedKeysMarshal{
+		{"id", l.Id},
+		{"timestamp", l.Timestamp},
+		{"content", l.Content},
+	}
+}
+
+// Number of latest sequenced messages kept for each user for replay on reconnection
+const GameRoomReplayLimit = 64
+
+// Sequence numbers reserved in the snapshot at a time
+const GameRoomSeqReserve = 100
+
+// Absence after which a user's outbox is dropped; they get the full state on return
+const GameRoomReplayWindow = 5 * time.Minute
+
+type GameRoomOutboxEntry struct {
+	Seq     int
+	Message OrderedKeysMarshal
+}
+
+// Sequenced messages sent to a user, kept across reconnections
+type GameRoomOutbox struct {
+	Entries []GameRoomOutboxEntry
+	Evicted int // Sequence number of the latest message no longer retained
+}
+
+func (o *GameRoomOutbox) Push(seq int, message OrderedKeysMarshal) {
+	if len(o.Entries) >= GameRoomReplayLimit {
+		o.Evicted = o.Entries[0].Seq
+		o.Entries = o.Entries[1:]
+	}
+	o.Entries = append(o.Entries, GameRoomOutboxEntry{Seq: seq, Message: message})
+}
+
+// Messages after `lastSeq`, or `false` if some of them are no longer retained
+func (o *GameRoomOutbox) Since(lastSeq int) ([]OrderedKeysMarshal, bool) {
+	if lastSeq < o.Evicted {
+		return nil, false
+	}
+	messages := []OrderedKeysMarshal{}
+	for _, entry := range o.Entries {
+		if entry.Seq > lastSeq {
+			messages = append(messages, entry.Message)
+		}
+	}
+	return messages, true
+}
+
+type GameRoom struct {
+	Room
+	GameRoomLifecycle
+	Conns     map[int]WebSocketConn
+	InChannel chan GameRoomInMessage
+	Signal    chan interface{}
+	Gameplay  GameplayState
+	Log       []GameRoomLog
+	Seq       int
+	Outbox    map[int]*GameRoomOutbox
+	Mutex     *sync.RWMutex
+
+	// Highest sequence number that a restored room may have sent
+	SeqReserved int
+
+	// Runs the room; the creator unless promoted in their absence
+	Host int
+
+	// Record of the game in progress (`Id` is 0 if none)
+	Game             Game
+	GameEventCount   int
+	GameActionsSaved int
+
+	// Pending move of a bot (nil if none)
+	BotTimer *time.Timer
+	// Pending move of a delegated player (nil if none)
+	DelegateTimer *time.Timer
+
+	// Vacant seats offered to spectators, by user ID
+	SeatOffers map[int]int
+	// When users who have left were last connected (Unix timestamps)
+	LastSeen map[int]int64
+}
+
+var GameRoomMapMutex = &sync.Mutex{}
+var GameRoomMap = make(map[int]*GameRoom)
+
+func GameRoomFind(roomId int) *GameRoom {
+	return GameRoomMap[roomId]
+}
+
+// Overview of a live room, as shown in the lobby
+type GameRoomSummary struct {
+	Room           Room
+	State          string
+	Phase          string
+	SeatedCount    int
+	ConnectedCount int
+	SpectatorCount int
+}
+
+// Only public rooms appear in listings and the lobby
+func (s *GameRoomSummary) Listed() bool {
+	return s.Room.Visibility == "public"
+}
+
+func (s *GameRoomSummary) Repr() OrderedKeysMarshal {
+	return append(s.Room.Repr(),
+		OrderedKeysEntry{"state", s.State},
+		OrderedKeysEntry{"phase", s.Phase},
+		OrderedKeysEntry{"seated_count", s.SeatedCount},
+		OrderedKeysEntry{"connected_count", s.ConnectedCount},
+		OrderedKeysEntry{"spectator_count", s.SpectatorCount},
+	)
+}
+
+// Assumes the mutex is held (RLock'ed)
+func (r *GameRoom) Summary() GameRoomSummary {
+	return GameRoomSummary{
+		Room:           r.Room,
+		State:          r.State,
+		Phase:          r.Gameplay.PhaseName(),
+		SeatedCount:    len(r.Gameplay.Players),
+		ConnectedCount: len(r.Conns),
+		SpectatorCount: r.SpectatorCount(),
+	}
+}
+
+// Assumes the mutex is held (RLock'ed)
+func (r *GameRoom) SpectatorCount() int {
+	n := 0
+	for _, conn := range r.Conns {
+		if conn.Spectator {
+			n++
+		}
+	}
+	return n
+}
+
+func GameRoomListOpen() []GameRoomSummary {
+	GameRoomMapMutex.Lock()
+	defer GameRoomMapMutex.Unlock()
+	summaries := []GameRoomSummary{}
+	for _, r := range GameRoomMap {
+		r.Mutex.RLock()
+		if r.State != RoomStateArchived {
+			summaries = append(summaries, r.Summary())
+		}
+		r.Mutex.RUnlock()
+	}
+	return summaries
+}
+
+func (r *GameRoom) HasJoined(userId int) bool {
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	if _, ok := r.Outbox[userId]; ok {
+		return true
+	}
+	// Outboxes of those away for long are dropped
+	_, ok := r.LastSeen[userId]
+	return ok
+}
+
+// Keeps the live room, if any, in sync with its updated record
+func GameRoomUpdate(room Room) {
+	GameRoomMapMutex.Lock()
+	r := GameRoomMap[room.Id]
+	GameRoomMapMutex.Unlock()
+	if r != nil {
+		r.Mutex.Lock()
+		// The creator may have handed the room over in the meantime
+		room.Creator = r.Room.Creator
+		r.Room = room
+		r.Mutex.Unlock()
+		// Announced by the room itself along with its other changes.
+		// Does not block: any pending signal wakes the room up all the same
+		select {
+		case r.Signal <- GameRoomSignalRoomUpdate{}:
+		default:
+		}
+	}
+}
+
+// Whether the game is still being played in a live room
+func GameInProgress(game Game) bool {
+	GameRoomMapMutex.Lock()
+	r := GameRoomMap[game.Room]
+	GameRoomMapMutex.Unlock()
+	if r == nil {
+		return false
+	}
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	return r.Game.Id == game.Id
+}
+
+// A `lastSeq` of -1 denotes a fresh connection; otherwise missed messages are replayed
+func (r *GameRoom) Join(user User, channel chan interface{}, lastSeq int, spectator bool) int {
+	r.Mutex.Lock()
+	playerIndex := len(r.Conns)
+	r.Conns[user.Id] = WebSocketConn{User: user, OutChannel: channel, Spectator: spectator, Pending: true}
+	r.Mutex.Unlock()
+	if lastSeq == -1 {
+		r.Signal <- GameRoomSignalNewConn{
+			UserId:  user.Id,
+			Channel: channel,
+		}
+	} else {
+		r.Signal <- GameRoomSignalReEstConn{
+			UserId:  user.Id,
+			Channel: channel,
+			LastSeq: lastSeq,
+		}
+	}
+	return playerIndex
+}
+
+// Stops delivery to the connection at once, as its channel is closed
+// right after; the room is notified afterwards
+func (r *GameRoom) Lost(userId int, channel chan interface{}) {
+	r.Mutex.Lock()
+	removed := false
+	if conn, ok := r.Conns[userId]; ok && conn.OutChannel == channel {
+		r.removeConn(userId)
+		removed = true
+	}
+	closed := (r.State == RoomStateArchived)
+	r.Mutex.Unlock()
+	if !closed {
+		r.Signal <- GameRoomSignalLostConn{
+			UserId:  userId,
+			Removed: removed,
+		}
+	}
+}
+
+// Assumes the mutex is held (Lock'ed)
+func (r *GameRoom) removeConn(userId int) {
+	delete(r.Conns, userId)
+	r.LastSeen[userId] = time.Now().Unix()
+}
+
+// Whether the player is connected, and if not, when they were last (nil if never).
+// Assumes the mutex is held (RLock'ed)
+func (r *GameRoom) Presence(p GameplayPlayer) (bool, interface{}) {
+	if p.IsBot() {
+		return true, nil
+	}
+	if _, ok := r.Conns[p.User.Id]; ok {
+		return true, nil
+	}
+	lastSeen, ok := r.LastSeen[p.User.Id]
+	return false, validOrNil(ok, lastSeen)
+}
+
+// Assumes the mutex is held (RLock'ed)
+func (r *GameRoom) StateMessage(userId int) OrderedKeysMarshal {
+	entries := OrderedKeysMarshal{
+		{"type", "room_state"},
+		{"room", r.Room.Repr()},
+		{"state", r.State},
+		{"host", r.Host},
+		{"my_index", r.Gameplay.PlayerIndexNullable(userId)},
+		{"spectator_count", r.SpectatorCount()},
+		{"paused", r.Gameplay.Paused()},
+	}
+	entries = append(entries, r.Gameplay.Repr(r, userId)...)
+	return entries
+}
+
+func (r *GameRoom) LogMessage(history int) OrderedKeysMarshal {
+	logsReprs := []OrderedKeysMarshal{}
+	logs := r.Log
+	if history > 0 {
+		logs = r.Log[len(r.Log)-history:]
+	}
+	for _, entry := range logs {
+		logsReprs = append(logsReprs, entry.Repr())
+	}
+	return OrderedKeysMarshal{
+		{"type", "log"},
+		{"log", logsReprs},
+	}
+}
+
+// Older entries from the database, for clients scrolling back
+func (r *GameRoom) LogHistoryMessage(beforeId int, limit int) OrderedKeysMarshal {
+	// Fetch one extra entry to tell whether there are more
+	logs := GameLogListBefore(r.Room.Id, beforeId, limit+1)
+	hasMore := len(logs) > limit
+	if hasMore {
+		logs = logs[1:]
+	}
+	logsReprs := []OrderedKeysMarshal{}
+	for _, entry := range logs {
+		logsReprs = append(logsReprs, entry.Repr())
+	}
+	return OrderedKeysMarshal{
+		{"type", "log"},
+		{"log", logsReprs},
+		{"has_more", hasMore},
+	}
+}
+
+// Messaging subroutines assume the mutex is held (Lock'ed),
+// as sequence numbers and outboxes are updated
+
+// Attaches the sequence number, records the message in the user's outbox,
+// and delivers it if the user is connected
+func (r *GameRoom) Send(userId int, seq int, message OrderedKeysMarshal) {
+	sequenced := OrderedKeysMarshal{message[0], {"seq", seq}}
+	sequenced = append(sequenced, message[1:]...)
+
+	outbox, ok := r.Outbox[userId]
+	if !ok {
+		outbox = &GameRoomOutbox{}
+		r.Outbox[userId] = outbox
+	}
+	outbox.Push(seq, sequenced)
+
+	if conn, ok := r.Conns[userId]; ok && !conn.Pending {
+		conn.OutChannel <- sequenced
+	}
+}
+
+func (r *GameRoom) NextSeq() int {
+	r.Seq++
+	// Snapshots may lag behind; numbers are reserved ahead in them,
+	// so that none already sent is used again after a crash
+	if r.Seq > r.SeqReserved {
+		r.SeqReserved = r.Seq + GameRoomSeqReserve
+		r.SaveSnapshot()
+	}
+	return r.Seq
+}
+
+// Sends a message to a single user
+func (r *GameRoom) Unicast(userId int, message OrderedKeysMarshal) {
+	r.Send(userId, r.NextSeq(), message)
+}
+
+// Sends the same message to everyone who has joined
+func (r *GameRoom) Broadcast(message OrderedKeysMarshal) {
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		r.Send(userId, seq, message)
+	}
+}
+
+// Whether the connection is still the user's current one, yet to catch up
+func (r *GameRoom) IsPending(userId int, channel chan interface{}) bool {
+	conn, ok := r.Conns[userId]
+	return ok && conn.OutChannel == channel && conn.Pending
+}
+
+// Starts delivering live messages to a connection that has caught up
+func (r *GameRoom) SetLive(userId int) {
+	conn := r.Conns[userId]
+	conn.Pending = false
+	r.Conns[userId] = conn
+}
+
+// Sends the full state to a newly connected user
+func (r *GameRoom) Welcome(userId int) {
+	if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+		r.BroadcastAssemblyUpdate(userId)
+	}
+	r.Unicast(userId, r.StateMessage(userId))
+	r.Unicast(userId, r.LogMessage(0))
+}
+
+// Replays messages missed since `lastSeq` to a pending connection;
+// returns `false` if not possible
+func (r *GameRoom) Resume(userId int, lastSeq int) bool {
+	outbox, ok := r.Outbox[userId]
+	if !ok || lastSeq > r.Seq {
+		return false
+	}
+	messages, ok := outbox.Since(lastSeq)
+	if !ok {
+		return false
+	}
+	conn := r.Conns[userId]
+	for _, message := range messages {
+		conn.OutChannel <- message
+	}
+	r.SetLive(userId)
+	if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+		r.BroadcastAssemblyUpdate(-1)
+	}
+	return true
+}
+
+// Drops the outboxes of users away for longer than the replay window,
+// so that broadcasts are no longer built for them
+func (r *GameRoom) PruneOutboxes(now time.Time) {
+	for userId := range r.Outbox {
+		if _, ok := r.Conns[userId]; ok {
+			continue
+		}
+		lastSeen, ok := r.LastSeen[userId]
+		if !ok || now.Sub(time.Unix(lastSeen, 0)) >= GameRoomReplayWindow {
+			delete(r.Outbox, userId)
+		}
+	}
+}
+
+// Broadcasts reach everyone who has joined, including those temporarily
+// disconnected, so that missed messages can be replayed on reconnection
+
+func (r *GameRoom) BroadcastStart() {
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		r.Send(userId, seq, OrderedKeysMarshal{
 			{"type", "start"},
+			{"game_id", r.Game.Id},
 			{"holder", r.Gameplay.PhaseStatus.(GameplayPhaseStatusAppointment).Holder},
 			{"my_index", r.Gameplay.PlayerIndexNullable(userId)},
-			{"timer", json.Number(fmt.Sprintf("%.1f", TimeLimitAppointment.Seconds()))},
-		}
+			{"timer", json.Number(fmt.Sprintf("%.1f", r.Gameplay.Settings.TimeLimitAppointment.Duration().Seconds()))},
+			{"deadline", r.Gameplay.PhaseStatus.(GameplayPhaseStatusAppointment).Timer.Deadline()},
+		})
 	}
 }
 
 func (r *GameRoom) BroadcastRoomState() {
-	for userId, conn := range r.Conns {
-		conn.OutChannel <- r.StateMessage(userId)
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		r.Send(userId, seq, r.StateMessage(userId))
 	}
 }
 
@@ -1005,15 +1856,17 @@ func (r *GameRoom) BroadcastAssemblyUpdate(skipUserId int) {
 		{"type", "assembly_update"},
 		{"players", r.Gameplay.PlayerReprs(r)},
 	}
-	for userId, conn := range r.Conns {
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
 		if userId != skipUserId {
-			conn.OutChannel <- message
+			r.Send(userId, seq, message)
 		}
 	}
 }
 
 func (r *GameRoom) BroadcastAppointmentUpdate(prevHolder int, nextHolder int, isStarting bool, isTimeout bool) {
-	for userId, conn := range r.Conns {
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
 		var message OrderedKeysMarshal
 		if isStarting {
 			var prevVal interface{}
@@ -1022,11 +1875,10 @@ func (r *GameRoom) BroadcastAppointmentUpdate(prevHolder int, nextHolder int, is
 			} else {
 				prevVal = prevHolder
 			}
-			st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
 			message = OrderedKeysMarshal{
 				{"type", "appointment_accept"},
 				{"prev_holder", prevVal},
-				{"gameplay_status", st.ReprWithEvent(r.Gameplay.PlayerIndex(userId), "appointment_accept", isTimeout)},
+				{"gameplay_status", r.Gameplay.GameplayStatusRepr(r, r.Gameplay.PlayerIndex(userId), "appointment_accept", isTimeout)},
 			}
 		} else {
 			message = OrderedKeysMarshal{
@@ -1034,10 +1886,11 @@ func (r *GameRoom) BroadcastAppointmentUpdate(prevHolder int, nextHolder int, is
 				{"prev_holder", prevHolder},
 				{"next_holder", nextHolder},
 				{"is_timeout", isTimeout},
-				{"timer", json.Number(fmt.Sprintf("%.1f", TimeLimitAppointment.Seconds()))},
+				{"timer", json.Number(fmt.Sprintf("%.1f", r.Gameplay.Settings.TimeLimitAppointment.Duration().Seconds()))},
+				{"deadline", r.Gameplay.PhaseStatus.(GameplayPhaseStatusAppointment).Timer.Deadline()},
 			}
 		}
-		conn.OutChannel <- message
+		r.Send(userId, seq, message)
 	}
 }
 
@@ -1046,46 +1899,370 @@ func (r *GameRoom) BroadcastLog(text string) {
 	lines := strings.Split(text, "\n")
 
 	// Append to log
-	// Keep only 5 latest
+	// Persist everything, but keep only the latest few in memory
 	for _, line := range lines {
 		entry := GameRoomLog{Id: 0, Timestamp: time.Now().Unix(), Content: line}
 		if len(r.Log) >= 1 {
 			entry.Id = r.Log[len(r.Log)-1].Id + 1
 		}
-		if len(r.Log) >= 5 {
-			for i := range 4 {
-				r.Log[i] = r.Log[i+1]
-			}
-			r.Log[4] = entry
+		entry.Save(r.Room.Id)
+		if len(r.Log) >= GameRoomLogRecent {
+			copy(r.Log, r.Log[1:])
+			r.Log[len(r.Log)-1] = entry
 		} else {
 			r.Log = append(r.Log, entry)
 		}
 	}
 
 	message := r.LogMessage(len(lines))
-	for _, conn := range r.Conns {
-		conn.OutChannel <- message
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		r.Send(userId, seq, message)
 	}
 }
 
 func (r *GameRoom) BroadcastGameProgress(event string, isTimeout bool) {
-	st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
-	for userId, conn := range r.Conns {
-		conn.OutChannel <- OrderedKeysMarshal{
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		r.Send(userId, seq, OrderedKeysMarshal{
 			{"type", "gameplay_progress"},
-			{"gameplay_status", st.ReprWithEvent(r.Gameplay.PlayerIndex(userId), event, isTimeout)},
+			{"gameplay_status", r.Gameplay.GameplayStatusRepr(r, r.Gameplay.PlayerIndex(userId), event, isTimeout)},
+		})
+	}
+}
+
+func (r *GameRoom) BroadcastGameEnd() {
+	st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
+	seq := r.NextSeq()
+	for userId, _ := range r.Outbox {
+		// Spectators learn only that the game has ended
+		playerIndex := r.Gameplay.PlayerIndex(userId)
+		var relationship, growthPoints interface{}
+		if playerIndex != -1 {
+			relationship = st.Player[playerIndex].Relationship
+			growthPoints = st.Player[playerIndex].GrowthPoints
+		}
+		r.Send(userId, seq, OrderedKeysMarshal{
+			{"type", "game_end"},
+			{"game_id", r.Game.Id},
+			{"relationship", relationship},
+			{"growth_points", growthPoints},
+		})
+	}
+}
+
+func (r *GameRoom) BroadcastPaused() {
+	t, _ := r.Gameplay.PhaseTimer()
+	r.Broadcast(OrderedKeysMarshal{
+		{"type", "pause_update"},
+		{"paused", t.Paused},
+		{"timer", json.Number(fmt.Sprintf("%.1f", t.Remaining().Seconds()))},
+		{"deadline", t.Deadline()},
+	})
+}
+
+// Tells everyone that a seated player has come or gone
+func (r *GameRoom) BroadcastPresence(userId int) {
+	seat := r.Gameplay.PlayerIndex(userId)
+	if seat == -1 {
+		return
+	}
+	online, lastSeen := r.Presence(r.Gameplay.Players[seat])
+	r.Broadcast(OrderedKeysMarshal{
+		{"type", "presence"},
+		{"seat", seat},
+		{"user_id", userId},
+		{"online", online},
+		{"last_seen", lastSeen},
+	})
+}
+
+func (r *GameRoom) BroadcastSpectatorCount() {
+	r.Broadcast(OrderedKeysMarshal{
+		{"type", "spectator_count"},
+		{"count", r.SpectatorCount()},
+	})
+}
+
+////// Game records //////
+// All assume the mutex is held (Lock'ed)
+
+func (r *GameRoom) saveGameEvent(eventType string, userId int, payload interface{}) {
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	event := GameEvent{
+		Game:      r.Game.Id,
+		Index:     r.GameEventCount,
+		Timestamp: time.Now().Unix(),
+		Type:      eventType,
+		UserId:    userId,
+		Payload:   string(payloadJson),
+	}
+	event.Save()
+	r.GameEventCount++
+}
+
+// Starts the event stream with the seated players and the seed
+func (r *GameRoom) RecordGameStart(userId int) {
+	r.Game = Game{
+		Room:      r.Room.Id,
+		Seed:      r.Gameplay.Seed,
+		StartedAt: time.Now().Unix(),
+	}
+	r.Game.Save()
+	r.GameEventCount = 0
+	r.GameActionsSaved = 0
+	for i, p := range r.Gameplay.Players {
+		participant := GameParticipant{
+			Game:    r.Game.Id,
+			Seat:    i,
+			User:    p.User.Id,
+			Profile: p.Profile.Id,
+		}
+		participant.Save()
+		r.saveGameEvent("seat", p.User.Id, p.Record())
+	}
+	r.saveGameEvent("start", userId, GameplayStartRecord{
+		Seed:           r.Gameplay.Seed,
+		ContentVersion: r.Gameplay.Content.Version,
+		Settings:       &r.Gameplay.Settings,
+	})
+	r.State = RoomStateInGame
+	r.SaveSnapshot()
+}
+
+// Appends commands accepted since the last call to the event stream
+func (r *GameRoom) RecordGameActions() {
+	if r.Game.Id == 0 {
+		return
+	}
+	for _, action := range r.Gameplay.Actions[r.GameActionsSaved:] {
+		r.saveGameEvent(action.Type, action.UserId, action)
+	}
+	r.GameActionsSaved = len(r.Gameplay.Actions)
+}
+
+// Called when the last storyteller finishes
+func (r *GameRoom) EndGame() {
+	r.BroadcastGameEnd()
+	if r.Game.Id != 0 {
+		r.Game.EndedAt = time.Now().Unix()
+		r.Game.Save()
+		st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
+		for i, p := range r.Gameplay.Players {
+			participant := GameParticipant{
+				Game:         r.Game.Id,
+				Seat:         i,
+				Substitution: GameParticipantLastSubstitution(r.Game.Id, i),
+				User:         p.User.Id,
+				Profile:      p.Profile.Id,
+				Relationship: st.Player[i].Relationship,
+				GrowthPoints: st.Player[i].GrowthPoints,
+			}
+			participant.Save()
+			if st.Player[i].GrowthPoints > 0 && !p.IsBot() {
+				ProfileGrowthCredit(p.Profile.Id, r.Game.Id, st.Player[i].GrowthPoints)
+			}
 		}
 	}
+	log.Printf("Room %d: game %d ended (seed %d, %d actions)\n",
+		r.Room.Id, r.Game.Id, r.Gameplay.Seed, len(r.Gameplay.Actions))
+	r.Gameplay.Reset()
+	r.Game = Game{}
+	r.SeatOffers = map[int]int{}
+	r.State = RoomStateFinished
+	r.SaveSnapshot()
+}
+
+////// Gameplay commands //////
+// Issued by players or on timeouts (`userId` of -1)
+// Each returns the error message, and assumes the mutex is held (Lock'ed)
+
+func (r *GameRoom) CommandAppointment(userId int, accept bool) string {
+	if r.Gameplay.Paused() {
+		return "Game paused"
+	}
+	prevHolder, nextHolder, isStarting, err, logContent :=
+		r.Gameplay.AppointmentAcceptOrPass(userId, accept, r.Signal)
+	if err != "" {
+		return err
+	}
+	r.Gameplay.ClearMissedTimers(userId)
+	r.RecordGameActions()
+	r.BroadcastAppointmentUpdate(prevHolder, nextHolder, isStarting, userId == -1)
+	r.BroadcastLog(logContent)
+	return ""
+}
+
+func (r *GameRoom) CommandAction(userId int, handIndex int, arenaIndex int, target int) string {
+	if r.Gameplay.Paused() {
+		return "Game paused"
+	}
+	err, logContent := r.Gameplay.ActionCheck(userId, handIndex, arenaIndex, target)
+	if err != "" {
+		return err
+	}
+	r.Gameplay.ClearMissedTimers(userId)
+	r.RecordGameActions()
+	r.BroadcastGameProgress("action_check", userId == -1)
+	r.BroadcastLog(logContent)
+	return ""
+}
+
+func (r *GameRoom) CommandStorytellingEnd(userId int) string {
+	if r.Gameplay.Paused() {
+		return "Game paused"
+	}
+	isNewMove, isGameEnd, err, logContent := r.Gameplay.StorytellingEnd(userId)
+	if err != "" {
+		return err
+	}
+	r.Gameplay.ClearMissedTimers(userId)
+	r.RecordGameActions()
+	if isGameEnd {
+		r.BroadcastLog(logContent)
+		r.EndGame()
+	} else {
+		var event string
+		if isNewMove {
+			event = "storytelling_end_new_move"
+		} else {
+			event = "storytelling_end_next_storyteller"
+		}
+		r.BroadcastGameProgress(event, userId == -1)
+		r.BroadcastLog(logContent)
+	}
+	return ""
+}
+
+func (r *GameRoom) CommandQueue(userId int) string {
+	if r.Gameplay.Paused() {
+		return "Game paused"
+	}
+	err := r.Gameplay.Queue(userId)
+	if err != "" {
+		return err
+	}
+	r.RecordGameActions()
+	r.BroadcastGameProgress("queue", false)
+	return ""
+}
+
+func (r *GameRoom) CommandExtend(userId int) string {
+	if r.Gameplay.Paused() {
+		return "Game paused"
+	}
+	err, logContent := r.Gameplay.Extend(userId)
+	if err != "" {
+		return err
+	}
+	r.RecordGameActions()
+	r.BroadcastGameProgress("extend", userId == -1)
+	r.BroadcastLog(logContent)
+	return ""
+}
+
+// Acts for the awaited seat as if its timer of the given phase ran out
+func (r *GameRoom) CommandTimeout(phase string) string {
+	if r.Gameplay.PhaseName() != phase {
+		return "Not in " + phase + " phase"
+	}
+	switch st := r.Gameplay.PhaseStatus.(type) {
+	case GameplayPhaseStatusAppointment:
+		return r.CommandAppointment(-1, false)
+	case GameplayPhaseStatusGameplay:
+		if st.Step == "selection" {
+			// Select random card
+			return r.CommandAction(-1, -1, -1, -1)
+		} else {
+			// Stop storytelling
+			return r.CommandStorytellingEnd(-1)
+		}
+	}
+	return "Game not started"
+}
+
+////// Delegation //////
+// All assume the mutex is held (Lock'ed)
+
+func (r *GameRoom) Delegate(userId int, delegated bool, isTimeout bool) string {
+	err, logContent := r.Gameplay.SetDelegated(userId, delegated, isTimeout)
+	if err != "" {
+		return err
+	}
+	if logContent != "" {
+		r.Broadcast(OrderedKeysMarshal{
+			{"type", "delegate_update"},
+			{"seat", r.Gameplay.PlayerIndex(userId)},
+			{"delegated", delegated},
+			{"is_timeout", isTimeout},
+		})
+		r.BroadcastLog(logContent)
+	}
+	return ""
+}
+
+// Handles a timer that ran out, delegating players who keep missing theirs
+func (r *GameRoom) Timeout(phase string) {
+	seat := r.Gameplay.ActingSeat()
+	if seat == -1 || r.Gameplay.Paused() {
+		return
+	}
+	userId := r.Gameplay.Players[seat].User.Id
+	// Neither draw on the bank nor play for a player who has just moved
+	if !r.Gameplay.TimerExpired() {
+		return
+	}
+	// Draw on the time bank first
+	if phase == "gameplay" && r.CommandExtend(-1) == "" {
+		return
+	}
+	if r.CommandTimeout(phase) != "" {
+		return
+	}
+	if r.Gameplay.MissTimer(userId) {
+		r.Delegate(userId, true, true)
+	}
+}
+
+func (r *GameRoom) delegatedToAct() int {
+	seat := r.Gameplay.ActingSeat()
+	if seat == -1 || !r.Gameplay.Players[seat].Delegated || r.Gameplay.Paused() {
+		return -1
+	}
+	return seat
+}
+
+// Arms the timer for the move of the awaited player, if delegated and none is pending
+func (r *GameRoom) ScheduleDelegated() {
+	if r.DelegateTimer != nil || r.delegatedToAct() == -1 {
+		return
+	}
+	// Signalled at once, but through the room loop, so that each move
+	// is handled on its own and other messages may come in between
+	signal := r.Signal
+	r.DelegateTimer = time.AfterFunc(0, func() {
+		signal <- GameRoomSignalTimer{Type: "delegate"}
+	})
+}
+
+func (r *GameRoom) StopDelegated() {
+	if r.DelegateTimer != nil {
+		r.DelegateTimer.Stop()
+		r.DelegateTimer = nil
+	}
 }
 
-func (r *GameRoom) BroadcastGameEnd() {
-	st := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay)
-	for userId, conn := range r.Conns {
-		conn.OutChannel <- OrderedKeysMarshal{
-			{"type", "game_end"},
-			{"relationship", st.Player[r.Gameplay.PlayerIndex(userId)].Relationship},
-			{"growth_points", st.Player[r.Gameplay.PlayerIndex(userId)].GrowthPoints},
-		}
+// Makes the due move of a delegated player, one at a time
+func (r *GameRoom) DelegateStep() {
+	r.DelegateTimer = nil
+	if r.delegatedToAct() == -1 {
+		return
+	}
+	if err := r.CommandTimeout(r.Gameplay.PhaseName()); err != "" {
+		log.Printf("Room %d: delegated move: %s\n", r.Room.Id, err)
 	}
 }
 
@@ -1115,9 +2292,21 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 	var ok bool
 	conn, ok = r.Conns[msg.UserId]
 	if !ok {
-		log.Printf("Connection handling goes wrong\n")
+		// Removed (e.g. kicked) while the message was in flight
+		return
 	}
-	if message["type"] == "seat" {
+	if message["type"] == "ping" {
+		// Answered at once, outside the sequence of room messages
+		conn.OutChannel <- OrderedKeysMarshal{
+			{"type", "pong"},
+			{"time", time.Now().UnixMilli()},
+			{"client_time", message["client_time"]},
+		}
+		return
+	} else if message["type"] == "seat" {
+		if conn.Spectator {
+			panic("Spectators cannot be seated")
+		}
 		user := conn.User
 		profileId, ok := message["profile_id"].(float64)
 		if !ok {
@@ -1130,12 +2319,47 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 		if profile.Creator != user.Id {
 			panic("Not creator")
 		}
-		err, logContent := r.Gameplay.Seat(user, profile)
+		err, logContent := r.Gameplay.Seat(user, profile, r.Room.Settings.MaxPlayers)
 		if err != "" {
 			panic(err)
 		}
 		r.BroadcastAssemblyUpdate(-1)
 		r.BroadcastLog(logContent)
+	} else if message["type"] == "ready" || message["type"] == "unready" {
+		err, logContent := r.Gameplay.SetReady(msg.UserId, message["type"] == "ready")
+		if err != "" {
+			panic(err)
+		}
+		if logContent != "" {
+			r.BroadcastAssemblyUpdate(-1)
+			r.BroadcastLog(logContent)
+		}
+	} else if message["type"] == "add_bot" || message["type"] == "remove_bot" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); !ok {
+			panic("Not in assembly phase")
+		}
+		if message["type"] == "add_bot" {
+			strategy := "default"
+			if value, ok := message["strategy"]; ok && value != nil {
+				if strategy, ok = value.(string); !ok {
+					panic("Incorrect `strategy`")
+				}
+			}
+			if err := r.AddBot(strategy); err != "" {
+				panic(err)
+			}
+		} else {
+			targetId, ok := message["user_id"].(float64)
+			if !ok {
+				panic("Incorrect `user_id`")
+			}
+			if err := r.RemoveBot(int(targetId)); err != "" {
+				panic(err)
+			}
+		}
 	} else if message["type"] == "withdraw" {
 		err, logContent := r.Gameplay.WithdrawSeat(msg.UserId)
 		if err != "" {
@@ -1144,11 +2368,14 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 		r.BroadcastAssemblyUpdate(-1)
 		r.BroadcastLog(logContent)
 	} else if message["type"] == "start" {
-		if msg.UserId != r.Room.Creator {
-			panic("Not room creator")
+		if msg.UserId != r.Host {
+			panic("Not host")
 		}
 		// Ensure that all present players have seated
-		for userId, _ := range r.Conns {
+		for userId, conn := range r.Conns {
+			if conn.Spectator {
+				continue
+			}
 			seated := false
 			for _, p := range r.Gameplay.Players {
 				if p.User.Id == userId {
@@ -1160,20 +2387,32 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 				panic(fmt.Sprintf("Player (ID %d) is not seated", userId))
 			}
 		}
-		err, logContent := r.Gameplay.Start(r.Signal)
+		// Ensure that everyone seated is ready, and that seats are filled within limits
+		for _, p := range r.Gameplay.Players {
+			if !p.Ready {
+				panic(fmt.Sprintf("Player (ID %d) is not ready", p.User.Id))
+			}
+		}
+		if len(r.Gameplay.Players) < r.Room.Settings.MinPlayers {
+			panic("Not enough players")
+		}
+		if len(r.Gameplay.Players) > r.Room.Settings.MaxPlayers {
+			panic("Too many players")
+		}
+		err, logContent := r.Gameplay.Start(r.Signal, r.Room.Settings)
 		if err != "" {
 			panic(err)
 		}
+		r.RecordGameStart(msg.UserId)
+		log.Printf("Room %d: game %d started with seed %d\n",
+			r.Room.Id, r.Game.Id, r.Gameplay.Seed)
 		r.BroadcastStart()
 		r.BroadcastLog(logContent)
 	} else if message["type"] == "appointment_accept" || message["type"] == "appointment_pass" {
-		prevHolder, nextHolder, isStarting, err, logContent :=
-			r.Gameplay.AppointmentAcceptOrPass(msg.UserId, message["type"] == "appointment_accept", r.Signal)
+		err := r.CommandAppointment(msg.UserId, message["type"] == "appointment_accept")
 		if err != "" {
 			panic(err)
 		}
-		r.BroadcastAppointmentUpdate(prevHolder, nextHolder, isStarting, false)
-		r.BroadcastLog(logContent)
 	} else if message["type"] == "action" {
 		handIndex, ok := message["hand_index"].(float64)
 		if !ok {
@@ -1187,37 +2426,83 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 		if !ok {
 			target = -1
 		}
-		err, logContent := r.Gameplay.ActionCheck(msg.UserId, int(handIndex), int(arenaIndex), int(target))
+		err := r.CommandAction(msg.UserId, int(handIndex), int(arenaIndex), int(target))
 		if err != "" {
 			panic(err)
 		}
-		r.BroadcastGameProgress("action_check", false)
-		r.BroadcastLog(logContent)
 	} else if message["type"] == "storytelling_end" {
-		isNewMove, isGameEnd, err, logContent := r.Gameplay.StorytellingEnd(msg.UserId)
+		err := r.CommandStorytellingEnd(msg.UserId)
 		if err != "" {
 			panic(err)
 		}
-		if isGameEnd {
-			r.BroadcastLog(logContent)
-			r.BroadcastGameEnd()
-			r.Gameplay.Reset()
-		} else {
-			var event string
-			if isNewMove {
-				event = "storytelling_end_new_move"
-			} else {
-				event = "storytelling_end_next_storyteller"
-			}
-			r.BroadcastGameProgress(event, false)
-			r.BroadcastLog(logContent)
-		}
 	} else if message["type"] == "queue" {
-		err := r.Gameplay.Queue(msg.UserId)
+		err := r.CommandQueue(msg.UserId)
+		if err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "extend" {
+		err := r.CommandExtend(msg.UserId)
+		if err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "delegate" {
+		delegated, ok := message["enabled"].(bool)
+		if !ok {
+			panic("Incorrect `enabled`")
+		}
+		err := r.Delegate(msg.UserId, delegated, false)
 		if err != "" {
 			panic(err)
 		}
-		r.BroadcastGameProgress("queue", false)
+	} else if message["type"] == "offer_seat" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		seat, ok := message["seat"].(float64)
+		if !ok {
+			panic("Incorrect `seat`")
+		}
+		targetId, ok := message["user_id"].(float64)
+		if !ok {
+			panic("Incorrect `user_id`")
+		}
+		if err := r.OfferSeat(int(seat), int(targetId)); err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "accept_seat" {
+		profileId, ok := message["profile_id"].(float64)
+		if !ok {
+			panic("Incorrect `profile_id`")
+		}
+		profile := Profile{Id: int(profileId)}
+		if !profile.Load() {
+			panic("No such profile")
+		}
+		if profile.Creator != msg.UserId {
+			panic("Not creator")
+		}
+		if err := r.AcceptSeat(msg.UserId, profile); err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "decline_seat" {
+		if err := r.DeclineSeat(msg.UserId); err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "pause" || message["type"] == "resume" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		paused := (message["type"] == "pause")
+		if err := r.Gameplay.SetPaused(paused); err != "" {
+			panic(err)
+		}
+		r.BroadcastPaused()
+		if paused {
+			r.BroadcastLog("房主暂停了游戏")
+		} else {
+			r.BroadcastLog("房主恢复了游戏")
+		}
+		r.SaveSnapshot()
 	} else if message["type"] == "comment" {
 		text := fmt.Sprintf("%v", message["text"])
 		playerIndexStr := ""
@@ -1227,24 +2512,496 @@ func (r *GameRoom) ProcessMessage(msg GameRoomInMessage) {
 		if !isAssembly {
 			// playerIndexStr = fmt.Sprintf("座位 %d ", playerIndex+1)
 		}
-		logContent := fmt.Sprintf("%s玩家【%s】说：%s",
-			playerIndexStr, r.Gameplay.Players[playerIndex].User.Nickname, text)
+		role := "玩家"
+		if playerIndex == -1 && conn.Spectator {
+			role = "观众"
+		}
+		logContent := fmt.Sprintf("%s%s【%s】说：%s",
+			playerIndexStr, role, conn.User.Nickname, text)
 		r.BroadcastLog(logContent)
+	} else if message["type"] == "kick" || message["type"] == "ban" || message["type"] == "unban" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		targetId, ok := message["user_id"].(float64)
+		if !ok {
+			panic("Incorrect `user_id`")
+		}
+		var err string
+		if message["type"] == "unban" {
+			err = r.Unban(int(targetId))
+		} else {
+			err = r.Kick(int(targetId), message["type"] == "ban")
+		}
+		if err != "" {
+			panic(err)
+		}
+		if message["type"] != "kick" {
+			r.Unicast(msg.UserId, r.BanListMessage())
+		}
+	} else if message["type"] == "transfer_host" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		targetId, ok := message["user_id"].(float64)
+		if !ok {
+			panic("Incorrect `user_id`")
+		}
+		err := r.TransferHost(int(targetId), false)
+		if err != "" {
+			panic(err)
+		}
+	} else if message["type"] == "ban_list" {
+		if msg.UserId != r.Host {
+			panic("Not host")
+		}
+		r.Unicast(msg.UserId, r.BanListMessage())
+	} else if message["type"] == "log_history" {
+		beforeId := math.MaxInt
+		if value, ok := message["before_id"]; ok && value != nil {
+			n, ok := value.(float64)
+			if !ok {
+				panic("Incorrect `before_id`")
+			}
+			beforeId = int(n)
+		}
+		limit := 50
+		if value, ok := message["limit"]; ok && value != nil {
+			n, ok := value.(float64)
+			if !ok || n < 1 || n > 200 {
+				panic("Incorrect `limit`")
+			}
+			limit = int(n)
+		}
+		r.Unicast(msg.UserId, r.LogHistoryMessage(beforeId, limit))
 	} else {
 		panic("Unknown type")
 	}
 }
 
+////// Moderation //////
+// All assume the mutex is held (Lock'ed)
+
+// Removes a user from the room, withdrawing their seat if the game has not started.
+// A banned user cannot enter again until unbanned
+func (r *GameRoom) Kick(userId int, ban bool) string {
+	if userId == r.Host || userId == r.Room.Creator {
+		return "Cannot remove the host or the room creator"
+	}
+	user := User{Id: userId}
+	if !user.LoadById() {
+		return "No such user"
+	}
+	conn, connected := r.Conns[userId]
+	_, joined := r.Outbox[userId]
+	if !connected && !joined && !ban {
+		return "Not in room"
+	}
+
+	if ban {
+		RoomBanAdd(r.Room.Id, userId)
+	}
+	_, isAssembly := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly)
+	if isAssembly && r.Gameplay.PlayerIndex(userId) != -1 {
+		r.Gameplay.WithdrawSeat(userId)
+	}
+	if connected {
+		r.Unicast(userId, OrderedKeysMarshal{
+			{"type", "kicked"},
+			{"banned", ban},
+		})
+		// Signal to close connection
+		conn.OutChannel <- nil
+		r.removeConn(userId)
+	}
+	delete(r.Outbox, userId)
+	// Not to be let back in without the password or invite code
+	delete(r.LastSeen, userId)
+	// An offer made before the kick does not survive it
+	delete(r.SeatOffers, userId)
+
+	if isAssembly {
+		r.BroadcastAssemblyUpdate(-1)
+	} else {
+		r.BroadcastPresence(userId)
+	}
+	if ban {
+		r.BroadcastLog(fmt.Sprintf("玩家【%s】被房主禁止进入房间", user.Nickname))
+	} else {
+		r.BroadcastLog(fmt.Sprintf("玩家【%s】被房主请出房间", user.Nickname))
+	}
+	return ""
+}
+
+func (r *GameRoom) Unban(userId int) string {
+	if !RoomBanRemove(r.Room.Id, userId) {
+		return "Not banned"
+	}
+	return ""
+}
+
+func (r *GameRoom) BanListMessage() OrderedKeysMarshal {
+	userReprs := []OrderedKeysMarshal{}
+	for _, user := range RoomBanList(r.Room.Id) {
+		userReprs = append(userReprs, user.Repr())
+	}
+	return OrderedKeysMarshal{
+		{"type", "ban_list"},
+		{"users", userReprs},
+	}
+}
+
+////// Substitution //////
+// All assume the mutex is held (Lock'ed)
+
+// A seat is vacant during a game if its player is gone; bots never leave
+func (r *GameRoom) SeatVacant(seat int) bool {
+	p := r.Gameplay.Players[seat]
+	if p.IsBot() {
+		return false
+	}
+	_, ok := r.Conns[p.User.Id]
+	return !ok
+}
+
+func (r *GameRoom) OfferSeat(seat int, userId int) string {
+	if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
+		return "Game not started"
+	}
+	if seat < 0 || seat >= len(r.Gameplay.Players) {
+		return "`seat` out of range"
+	}
+	if !r.SeatVacant(seat) {
+		return "Seat not vacant"
+	}
+	conn, ok := r.Conns[userId]
+	if !ok || !conn.Spectator {
+		return "Not a spectator"
+	}
+	if r.Gameplay.PlayerIndex(userId) != -1 {
+		return "Already in game"
+	}
+	r.SeatOffers[userId] = seat
+	r.Unicast(userId, OrderedKeysMarshal{
+		{"type", "seat_offer"},
+		{"seat", seat},
+		{"player", r.Gameplay.Players[seat].User.Repr()},
+	})
+	r.BroadcastLog(fmt.Sprintf("房主邀请观众【%s】接替玩家【%s】的座位",
+		conn.User.Nickname, r.Gameplay.Players[seat].User.Nickname))
+	return ""
+}
+
+func (r *GameRoom) AcceptSeat(userId int, profile Profile) string {
+	seat, ok := r.SeatOffers[userId]
+	if !ok {
+		return "No seat offered"
+	}
+	delete(r.SeatOffers, userId)
+	if !r.SeatVacant(seat) {
+		return "Seat not vacant"
+	}
+	conn := r.Conns[userId]
+	err, logContent := r.Gameplay.Substitute(seat, conn.User, profile)
+	if err != "" {
+		return err
+	}
+	for otherId, otherSeat := range r.SeatOffers {
+		if otherSeat == seat {
+			delete(r.SeatOffers, otherId)
+		}
+	}
+	conn.Spectator = false
+	r.Conns[userId] = conn
+
+	player := r.Gameplay.Players[seat]
+	// The previous player keeps their own row
+	participant := GameParticipant{
+		Game:         r.Game.Id,
+		Seat:         seat,
+		Substitution: GameParticipantLastSubstitution(r.Game.Id, seat) + 1,
+		User:         userId,
+		Profile:      profile.Id,
+	}
+	participant.Save()
+	r.saveGameEvent("substitute", userId, GameplaySubstituteRecord{
+		Seat:   seat,
+		Player: player.Record(),
+	})
+	r.SaveSnapshot()
+
+	r.BroadcastRoomState()
+	r.BroadcastLog(logContent)
+	return ""
+}
+
+func (r *GameRoom) DeclineSeat(userId int) string {
+	if _, ok := r.SeatOffers[userId]; !ok {
+		return "No seat offered"
+	}
+	delete(r.SeatOffers, userId)
+	r.BroadcastLog(fmt.Sprintf("观众【%s】谢绝了接替座位的邀请", r.Conns[userId].User.Nickname))
+	return ""
+}
+
+////// Host //////
+// All assume the mutex is held (Lock'ed)
+
+// Hands hosting over to another connected player. When handed over by
+// the room's creator, the new host becomes the creator, also for later visits;
+// a host promoted in the absence of the previous one only runs this session
+func (r *GameRoom) TransferHost(userId int, isTimeout bool) string {
+	if userId == r.Host {
+		return "Already the host"
+	}
+	conn, ok := r.Conns[userId]
+	if !ok {
+		return "Not connected"
+	}
+	if conn.Spectator {
+		return "Cannot transfer to a spectator"
+	}
+	prevHost := User{Id: r.Host}
+	if !prevHost.LoadById() {
+		panic("Inconsistent databases")
+	}
+
+	if !isTimeout && r.Host == r.Room.Creator {
+		r.Room.Creator = userId
+		r.Room.SaveCreator()
+	}
+	r.Host = userId
+
+	r.BroadcastHostChange(isTimeout)
+	if isTimeout {
+		r.BroadcastLog(fmt.Sprintf("房主【%s】离开过久，房主改由玩家【%s】担任",
+			prevHost.Nickname, conn.User.Nickname))
+	} else {
+		r.BroadcastLog(fmt.Sprintf("房主【%s】将房主身份移交给玩家【%s】",
+			prevHost.Nickname, conn.User.Nickname))
+	}
+	return ""
+}
+
+// Gives hosting back to the room's creator on their return
+func (r *GameRoom) ReclaimHost() {
+	conn, ok := r.Conns[r.Room.Creator]
+	if r.Host == r.Room.Creator || !ok || conn.Spectator {
+		return
+	}
+	r.Host = r.Room.Creator
+	r.BroadcastHostChange(false)
+	r.BroadcastLog(fmt.Sprintf("房间创建者【%s】回到房间，重新担任房主", conn.User.Nickname))
+}
+
+func (r *GameRoom) BroadcastHostChange(isTimeout bool) {
+	r.Broadcast(OrderedKeysMarshal{
+		{"type", "host_change"},
+		{"room", r.Room.Repr()},
+		{"host", r.Host},
+		{"is_timeout", isTimeout},
+	})
+}
+
+// Candidate to take over from an absent host: connected seated players
+// in seat order, then other connected players by user ID; -1 if none.
+// Spectators are never promoted
+func (r *GameRoom) NextHost() int {
+	for _, p := range r.Gameplay.Players {
+		if conn, ok := r.Conns[p.User.Id]; ok && !conn.Spectator && p.User.Id != r.Host {
+			return p.User.Id
+		}
+	}
+	next := -1
+	for userId, conn := range r.Conns {
+		if !conn.Spectator && userId != r.Host && (next == -1 || userId < next) {
+			next = userId
+		}
+	}
+	return next
+}
+
+////// Snapshots //////
+
+// Interval of periodic snapshots of live rooms
+const GameRoomSnapshotInterval = 30 * time.Second
+
+type GameRoomSnapshot struct {
+	State            string           `json:"state"`
+	Seq              int              `json:"seq"`
+	SeqReserved      int              `json:"seq_reserved,omitempty"`
+	Host             int              `json:"host,omitempty"`
+	Gameplay         GameplaySnapshot `json:"gameplay"`
+	Game             int              `json:"game"`
+	GameEventCount   int              `json:"game_event_count"`
+	GameActionsSaved int              `json:"game_actions_saved"`
+	LastSeen         map[int]int64    `json:"last_seen,omitempty"`
+}
+
+// Assumes the mutex is held (RLock'ed)
+func (r *GameRoom) SaveSnapshot() {
+	snapshot := GameRoomSnapshot{
+		State:            r.State,
+		Seq:              r.Seq,
+		SeqReserved:      r.SeqReserved,
+		Host:             r.Host,
+		Gameplay:         r.Gameplay.Snapshot(),
+		Game:             r.Game.Id,
+		GameEventCount:   r.GameEventCount,
+		GameActionsSaved: r.GameActionsSaved,
+		LastSeen:         r.LastSeen,
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		panic(err)
+	}
+	RoomSnapshotSave(r.Room.Id, string(data))
+}
+
+// Assumes the mutex is held (Lock'ed)
+func (r *GameRoom) Restore(snapshot GameRoomSnapshot) {
+	// Continue past any number that may have been sent since the snapshot
+	r.Seq = max(snapshot.Seq, snapshot.SeqReserved)
+	r.SeqReserved = r.Seq
+	if snapshot.Host != 0 {
+		r.Host = snapshot.Host
+	}
+	// Timers are armed once the game is known to be up to date
+	r.Gameplay.Restore(snapshot.Gameplay, nil)
+	r.Game = Game{Id: snapshot.Game}
+	if r.Game.Id != 0 && !r.Game.Load() {
+		r.Game = Game{}
+	}
+	r.GameEventCount = snapshot.GameEventCount
+	r.GameActionsSaved = snapshot.GameActionsSaved
+	if snapshot.LastSeen != nil {
+		r.LastSeen = snapshot.LastSeen
+	}
+	if snapshot.State != "" {
+		r.State = snapshot.State
+	} else if r.Game.Id != 0 {
+		// Snapshots from before lifecycle states were recorded
+		r.State = RoomStateInGame
+	}
+	if r.Game.Id != 0 {
+		r.restoreGameEvents()
+	}
+	r.Gameplay.ArmTimers(r.Signal)
+}
+
+// Events are recorded as they happen, while snapshots are taken only now and then;
+// if the snapshot has fallen behind, the game is played again from its events,
+// and the timer of the current step starts over (once armed).
+// Assumes the mutex is held (Lock'ed)
+func (r *GameRoom) restoreGameEvents() {
+	events := GameEventList(r.Game.Id)
+	if len(events) == r.GameEventCount {
+		return
+	}
+	if r.Game.EndedAt != 0 {
+		// Ended, but the snapshot was not taken in time
+		r.Gameplay.Reset()
+		r.Game = Game{}
+		r.State = RoomStateFinished
+		return
+	}
+	state, err := GameplayReplayEvents(events)
+	if err == "" && state.PhaseName() == "assembly" {
+		err = "Not started"
+	}
+	if err != "" {
+		log.Printf("Room %d: game %d cannot be restored (%s)\n", r.Room.Id, r.Game.Id, err)
+		r.Gameplay.Reset()
+		r.Game = Game{}
+		r.State = RoomStateFinished
+		return
+	}
+	log.Printf("Room %d: game %d restored from events (%d in snapshot, %d recorded)\n",
+		r.Room.Id, r.Game.Id, r.GameEventCount, len(events))
+
+	// Delegation and pausing are not recorded as events
+	paused := r.Gameplay.Paused()
+	for i, p := range state.Players {
+		if seat := r.Gameplay.PlayerIndex(p.User.Id); seat != -1 {
+			state.Players[i].Delegated = r.Gameplay.Players[seat].Delegated
+		}
+	}
+	r.Gameplay = state
+	if paused {
+		r.Gameplay.SetPaused(true)
+	}
+	r.GameEventCount = events[len(events)-1].Index + 1
+	r.GameActionsSaved = len(r.Gameplay.Actions)
+
+	if r.Gameplay.Ended() {
+		r.EndGame()
+	}
+}
+
+func GameRoomSnapshotAll() {
+	GameRoomMapMutex.Lock()
+	defer GameRoomMapMutex.Unlock()
+	for _, r := range GameRoomMap {
+		r.Mutex.RLock()
+		if r.State != RoomStateArchived {
+			r.SaveSnapshot()
+		}
+		r.Mutex.RUnlock()
+	}
+	log.Printf("Saved snapshots of %d room(s)\n", len(GameRoomMap))
+}
+
+// Brings back all rooms that were live when the server stopped
+func GameRoomRestoreAll() {
+	for roomId, data := range RoomSnapshotList() {
+		var snapshot GameRoomSnapshot
+		room := Room{Id: roomId}
+		if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+			log.Printf("Room %d: discarding malformed snapshot (%v)\n", roomId, err)
+			RoomSnapshotDelete(roomId)
+			continue
+		}
+		if !room.Load() {
+			RoomSnapshotDelete(roomId)
+			continue
+		}
+		createdSignal := make(chan *GameRoom)
+		go GameRoomRun(room, &snapshot, createdSignal)
+		<-createdSignal
+		log.Printf("Room %d: restored in %s phase\n", roomId, snapshot.Gameplay.Phase)
+	}
+}
+
+// Logs a panic in a step not driven by a user's message, which would
+// otherwise take down the room; to be deferred
+func (r *GameRoom) recoverStep(step string) {
+	if obj := recover(); obj != nil {
+		log.Printf("Room %d: %s failed: %v\n", r.Room.Id, step, obj)
+	}
+}
+
+// Runs such a step with the mutex held (Lock'ed)
+func (r *GameRoom) RunGuarded(step string, f func()) {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+	defer r.recoverStep(step)
+	f()
+}
+
 // Should be run in a goroutine
-func GameRoomRun(room Room, createdSignal chan *GameRoom) {
+// `snapshot` is nil for a new (or reopened) room
+func GameRoomRun(room Room, snapshot *GameRoomSnapshot, createdSignal chan *GameRoom) {
 	GameRoomMapMutex.Lock()
 	if _, ok := GameRoomMap[room.Id]; ok {
 		GameRoomMapMutex.Unlock()
 		return
 	}
 	r := &GameRoom{
-		Room:      room,
-		Closed:    false,
+		Room: room,
+		GameRoomLifecycle: GameRoomLifecycle{
+			State:        RoomStateOpen,
+			LastActivity: time.Now(),
+		},
 		Conns:     map[int]WebSocketConn{},
 		InChannel: make(chan GameRoomInMessage, 4),
 		Signal:    make(chan interface{}, 2),
@@ -1252,52 +3009,100 @@ func GameRoomRun(room Room, createdSignal chan *GameRoom) {
 			Players:     []GameplayPlayer{},
 			PhaseStatus: GameplayPhaseStatusAssembly{},
 		},
-		Mutex: &sync.RWMutex{},
+		// Continue from the persisted log when the room is reopened
+		Log:        GameLogListBefore(room.Id, math.MaxInt, GameRoomLogRecent),
+		Seq:        0,
+		Outbox:     map[int]*GameRoomOutbox{},
+		Mutex:      &sync.RWMutex{},
+		SeatOffers: map[int]int{},
+		LastSeen:   map[int]int64{},
+		Host:       room.Creator,
+	}
+	if snapshot != nil {
+		r.Restore(*snapshot)
 	}
 	GameRoomMap[room.Id] = r
 	GameRoomMapMutex.Unlock()
 
-	timeoutDur := 180 * time.Second
-	timeoutTimer := time.NewTimer(timeoutDur)
-	defer timeoutTimer.Stop()
+	// Runs while the host is away
+	hostTimer := time.NewTimer(GameRoomHostTimeout)
+	defer hostTimer.Stop()
+
+	lifecycleTicker := time.NewTicker(GameRoomLifecycleInterval)
+	defer lifecycleTicker.Stop()
 
 	hahaTicker := time.NewTicker(10 * time.Second)
 	defer hahaTicker.Stop()
 
+	snapshotTicker := time.NewTicker(GameRoomSnapshotInterval)
+	defer snapshotTicker.Stop()
+
 	if createdSignal != nil {
 		createdSignal <- r
 	}
 
+	// Last state announced to the lobby
+	r.Mutex.RLock()
+	summary := r.Summary()
+	r.Mutex.RUnlock()
+	Lobby.BroadcastRoomOpen(summary)
+
 loop:
 	for {
 		select {
 		case msg := <-r.InChannel:
 			r.ProcessMessage(msg)
+			// Clock synchronization does not keep an idle room open
+			if msg.Message["type"] != "ping" {
+				r.Mutex.Lock()
+				r.Touch()
+				r.Mutex.Unlock()
+			}
 
 		case sig := <-r.Signal:
 			if sigNewConn, ok := sig.(GameRoomSignalNewConn); ok {
-				if sigNewConn.UserId == room.Creator {
-					timeoutTimer.Stop()
+				r.Mutex.Lock()
+				if sigNewConn.UserId == r.Room.Creator {
+					r.ReclaimHost()
 				}
-				r.Mutex.RLock()
-				conn := r.Conns[sigNewConn.UserId]
-				stateMessage := r.StateMessage(sigNewConn.UserId)
-				logMessage := r.LogMessage(0)
-				if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
-					r.BroadcastAssemblyUpdate(sigNewConn.UserId)
+				if sigNewConn.UserId == r.Host {
+					hostTimer.Stop()
+				}
+				r.Touch()
+				// The connection may have been lost or replaced in the meantime
+				if r.IsPending(sigNewConn.UserId, sigNewConn.Channel) {
+					r.SetLive(sigNewConn.UserId)
+					r.Welcome(sigNewConn.UserId)
+				}
+				r.BroadcastPresence(sigNewConn.UserId)
+				r.Mutex.Unlock()
+			}
+			if sigReEstConn, ok := sig.(GameRoomSignalReEstConn); ok {
+				r.Mutex.Lock()
+				if sigReEstConn.UserId == r.Room.Creator {
+					r.ReclaimHost()
 				}
-				r.Mutex.RUnlock()
-				conn.OutChannel <- stateMessage
-				conn.OutChannel <- logMessage
+				if sigReEstConn.UserId == r.Host {
+					hostTimer.Stop()
+				}
+				r.Touch()
+				if r.IsPending(sigReEstConn.UserId, sigReEstConn.Channel) &&
+					!r.Resume(sigReEstConn.UserId, sigReEstConn.LastSeq) {
+					// Too far behind, start over with the full state
+					r.SetLive(sigReEstConn.UserId)
+					r.Welcome(sigReEstConn.UserId)
+				}
+				r.BroadcastPresence(sigReEstConn.UserId)
+				r.Mutex.Unlock()
 			}
 			if sigLostConn, ok := sig.(GameRoomSignalLostConn); ok {
 				r.Mutex.Lock()
-				if r.Conns[sigLostConn.UserId].OutChannel == sigLostConn.Channel {
+				if sigLostConn.Removed {
 					println("connection lost", sigLostConn.UserId)
-					delete(r.Conns, sigLostConn.UserId)
-					if sigLostConn.UserId == room.Creator {
-						timeoutTimer.Reset(timeoutDur)
+					if sigLostConn.UserId == r.Host {
+						hostTimer.Reset(GameRoomHostTimeout)
 					}
+					r.BroadcastPresence(sigLostConn.UserId)
 				}
 				if _, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusAssembly); ok {
 					r.BroadcastAssemblyUpdate(sigLostConn.UserId)
@@ -1307,45 +3112,16 @@ loop:
 			if sigTimer, ok := sig.(GameRoomSignalTimer); ok {
 				println("timer", sigTimer.Type)
 				switch sigTimer.Type {
-				case "appointment":
-					r.Mutex.Lock()
-					prevHolder, nextHolder, isStarting, err, logContent :=
-						r.Gameplay.AppointmentAcceptOrPass(-1, false, r.Signal)
-					if err == "" {
-						r.BroadcastAppointmentUpdate(prevHolder, nextHolder, isStarting, true)
-					}
-					r.BroadcastLog(logContent)
-					r.Mutex.Unlock()
-
-				case "gameplay":
-					r.Mutex.Lock()
-					if st, ok := r.Gameplay.PhaseStatus.(GameplayPhaseStatusGameplay); ok {
-						if st.Step == "selection" {
-							// Select random card
-							_, logContent := r.Gameplay.ActionCheck(-1, -1, -1, -1)
-							r.BroadcastGameProgress("action_check", true)
-							r.BroadcastLog(logContent)
-						} else if st.Step == "storytelling_holder" || st.Step == "storytelling_target" {
-							// Stop storytelling
-							isNewMove, isGameEnd, _, logContent := r.Gameplay.StorytellingEnd(-1)
-							// XXX: DRY
-							if isGameEnd {
-								r.BroadcastLog(logContent)
-								r.BroadcastGameEnd()
-								r.Gameplay.Reset()
-							} else {
-								var event string
-								if isNewMove {
-									event = "storytelling_end_new_move"
-								} else {
-									event = "storytelling_end_next_storyteller"
-								}
-								r.BroadcastGameProgress(event, true)
-								r.BroadcastLog(logContent)
-							}
-						}
-					}
-					r.Mutex.Unlock()
+				case "appointment", "gameplay":
+					r.RunGuarded("timeout", func() {
+						r.Timeout(sigTimer.Type)
+					})
+
+				case "bot":
+					r.RunGuarded("bot", r.BotStep)
+
+				case "delegate":
+					r.RunGuarded("delegated move", r.DelegateStep)
 				}
 			}
 
@@ -1362,17 +3138,72 @@ loop:
 			} */
 			r.Mutex.RUnlock()
 
-		case <-timeoutTimer.C:
-			r.Closed = true
+		case <-snapshotTicker.C:
+			r.Mutex.RLock()
+			r.SaveSnapshot()
+			r.Mutex.RUnlock()
+
+		case <-hostTimer.C:
+			// Promote someone still present; if there is nobody,
+			// retry shortly until someone shows up or the room closes
+			r.RunGuarded("host change", func() {
+				if newHost := r.NextHost(); newHost != -1 {
+					r.TransferHost(newHost, true)
+				} else {
+					hostTimer.Reset(GameRoomLifecycleInterval)
+				}
+			})
+
+		case <-lifecycleTicker.C:
+			// Checked below
+		}
+
+		r.Mutex.Lock()
+		closing := r.UpdateLifecycle(time.Now())
+		if closing {
+			if r.Game.Id != 0 {
+				log.Printf("Room %d: game %d abandoned\n", r.Room.Id, r.Game.Id)
+			}
+			r.Gameplay.StopTimers()
+			r.StopBots()
+			r.StopDelegated()
+			r.State = RoomStateArchived
+		} else {
+			r.PruneOutboxes(time.Now())
+			r.ScheduleDelegated()
+			r.ScheduleBots()
+		}
+		r.Mutex.Unlock()
+		if closing {
 			GameRoomMapMutex.Lock()
 			delete(GameRoomMap, room.Id)
 			GameRoomMapMutex.Unlock()
+			RoomSnapshotDelete(room.Id)
+			Lobby.BroadcastRoomClose(summary)
 			break loop
 		}
+
+		// Announce changes in state, phase or player counts
+		r.Mutex.RLock()
+		newSummary := r.Summary()
+		r.Mutex.RUnlock()
+		// (Settings in the room record are not comparable with `==`)
+		if !reflect.DeepEqual(newSummary, summary) {
+			if newSummary.SpectatorCount != summary.SpectatorCount {
+				r.Mutex.Lock()
+				r.BroadcastSpectatorCount()
+				r.Mutex.Unlock()
+			}
+			Lobby.BroadcastRoomChange(summary, newSummary)
+			summary = newSummary
+		}
 	}
 
 	// Close all remaining channels
+	// (locked, as connections being lost are removed concurrently)
+	r.Mutex.Lock()
 	for _, conn := range r.Conns {
 		conn.OutChannel <- nil
 	}
+	r.Mutex.Unlock()
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+////// Room lifecycle //////
+// A live room is open (gathering players), in game, or finished (back to
+// gathering after a game). A closed room is archived until its creator reopens it
+
+const (
+	RoomStateOpen     = "open"
+	RoomStateInGame   = "in_game"
+	RoomStateFinished = "finished"
+	RoomStateArchived = "archived"
+)
+
+// Absence of the host before another player takes over
+const GameRoomHostTimeout = 180 * time.Second
+
+// Without anyone to play, a gathering room closes after a while;
+// a game in progress waits longer for its players to come back
+const GameRoomEmptyTimeout = 3 * time.Minute
+const GameRoomAbandonTimeout = 10 * time.Minute
+
+// A gathering room where nothing happens closes even with players connected
+const GameRoomIdleTimeout = 30 * time.Minute
+
+// Warning given before connections are cut
+const GameRoomClosingNotice = 30 * time.Second
+
+// Interval of checking the rules above
+const GameRoomLifecycleInterval = 1 * time.Second
+
+type GameRoomLifecycle struct {
+	State        string
+	LastActivity time.Time
+	// Since when nobody has been there to play (zero if someone is)
+	VacantSince time.Time
+	// When connections will be cut, once warned (zero if not closing)
+	ClosingAt time.Time
+}
+
+// State of a room, live or not
+func GameRoomState(roomId int) string {
+	GameRoomMapMutex.Lock()
+	r := GameRoomMap[roomId]
+	GameRoomMapMutex.Unlock()
+	if r == nil {
+		return RoomStateArchived
+	}
+	r.Mutex.RLock()
+	defer r.Mutex.RUnlock()
+	return r.State
+}
+
+// The remainder assume the mutex is held (Lock'ed)
+
+func (r *GameRoom) Touch() {
+	r.LastActivity = time.Now()
+}
+
+// Whether anyone who can play is connected: during a game, the seated players;
+// otherwise, anyone but spectators
+func (r *GameRoom) hasPlayersConnected() bool {
+	if r.State == RoomStateInGame {
+		for _, p := range r.Gameplay.Players {
+			if _, ok := r.Conns[p.User.Id]; ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, conn := range r.Conns {
+		if !conn.Spectator {
+			return true
+		}
+	}
+	return false
+}
+
+// Why and when the room should close; an empty reason if it should stay
+func (r *GameRoom) closeRule(now time.Time) (string, time.Time) {
+	if r.hasPlayersConnected() {
+		r.VacantSince = time.Time{}
+	} else if r.VacantSince.IsZero() {
+		r.VacantSince = now
+	}
+
+	if r.State == RoomStateInGame {
+		if !r.VacantSince.IsZero() {
+			return "abandoned", r.VacantSince.Add(GameRoomAbandonTimeout)
+		}
+		return "", time.Time{}
+	}
+	if !r.VacantSince.IsZero() {
+		return "empty", r.VacantSince.Add(GameRoomEmptyTimeout)
+	}
+	return "idle", r.LastActivity.Add(GameRoomIdleTimeout)
+}
+
+// Applies the close rules, warning everyone before closing and calling off
+// the warning if things change in the meantime.
+// Returns whether the room should close now
+func (r *GameRoom) UpdateLifecycle(now time.Time) bool {
+	reason, deadline := r.closeRule(now)
+	if reason == "" || now.Before(deadline) {
+		if !r.ClosingAt.IsZero() {
+			r.ClosingAt = time.Time{}
+			r.Broadcast(OrderedKeysMarshal{
+				{"type", "room_closing_cancel"},
+			})
+		}
+		return false
+	}
+	if r.ClosingAt.IsZero() {
+		r.ClosingAt = now.Add(GameRoomClosingNotice)
+		r.Broadcast(OrderedKeysMarshal{
+			{"type", "room_closing"},
+			{"reason", reason},
+			{"countdown", json.Number(fmt.Sprintf("%.1f", GameRoomClosingNotice.Seconds()))},
+		})
+		return false
+	}
+	return !now.Before(r.ClosingAt)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+////// Lobby //////
+// Pushes lifecycle events of live rooms to everyone browsing the lobby
+
+// Messages pending for a connection; a connection that falls this far behind is dropped
+const LobbyOutboxSize = 64
+
+type LobbyHub struct {
+	Conns map[chan interface{}]struct{}
+	Mutex *sync.Mutex
+}
+
+var Lobby = &LobbyHub{
+	Conns: map[chan interface{}]struct{}{},
+	Mutex: &sync.Mutex{},
+}
+
+// Registers a connection and queues the current list of rooms as its first message
+func (h *LobbyHub) Join(channel chan interface{}) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	roomReprs := []OrderedKeysMarshal{}
+	for _, s := range GameRoomListOpen() {
+		if s.Listed() {
+			roomReprs = append(roomReprs, s.Repr())
+		}
+	}
+	channel <- OrderedKeysMarshal{
+		{"type", "lobby_state"},
+		{"rooms", roomReprs},
+	}
+	h.Conns[channel] = struct{}{}
+}
+
+// Unregisters a connection and closes its channel, if not already done
+func (h *LobbyHub) Leave(channel chan interface{}) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	if _, ok := h.Conns[channel]; ok {
+		delete(h.Conns, channel)
+		close(channel)
+	}
+}
+
+func (h *LobbyHub) Broadcast(message OrderedKeysMarshal) {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+	for channel, _ := range h.Conns {
+		select {
+		case channel <- message:
+		default:
+			delete(h.Conns, channel)
+			close(channel)
+		}
+	}
+}
+
+// Rooms not listed are invisible to the lobby
+
+func (h *LobbyHub) BroadcastRoomOpen(summary GameRoomSummary) {
+	if !summary.Listed() {
+		return
+	}
+	h.Broadcast(OrderedKeysMarshal{
+		{"type", "room_open"},
+		{"room", summary.Repr()},
+	})
+}
+
+// A room becoming listed or unlisted appears to open or close
+func (h *LobbyHub) BroadcastRoomChange(prev GameRoomSummary, summary GameRoomSummary) {
+	if !prev.Listed() {
+		h.BroadcastRoomOpen(summary)
+		return
+	}
+	if !summary.Listed() {
+		h.BroadcastRoomClose(prev)
+		return
+	}
+	h.Broadcast(OrderedKeysMarshal{
+		{"type", "room_update"},
+		{"room", summary.Repr()},
+	})
+}
+
+func (h *LobbyHub) BroadcastRoomClose(summary GameRoomSummary) {
+	if !summary.Listed() {
+		return
+	}
+	h.Broadcast(OrderedKeysMarshal{
+		{"type", "room_close"},
+		{"room_id", strconv.Itoa(summary.Room.Id)},
+	})
+}
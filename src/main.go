@@ -6,8 +6,9 @@ import (
 )
 
 var Config struct {
-	Port  int  `json:"port"`
-	Debug bool `json:"debug"`
+	Port    int    `json:"port"`
+	Debug   bool   `json:"debug"`
+	Content string `json:"content"`
 }
 
 func main() {
@@ -23,10 +24,17 @@ func main() {
 	if err = json.Unmarshal(content, &Config); err != nil {
 		panic(err)
 	}
+	if Config.Content == "" {
+		Config.Content = "content.json"
+	}
 
 	if err := ConnectSQL(); err != nil {
 		panic(err)
 	}
 	ConnectRedis()
+	if err := LoadContent(); err != nil {
+		panic(err)
+	}
+	GameRoomRestoreAll()
 	ServerListen()
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -10,6 +12,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/redis/go-redis/v9"
@@ -36,7 +39,6 @@ func InitializeSchemata() error {
 		var cmd strings.Builder
 		cmd.WriteString("CREATE TABLE IF NOT EXISTS " + schema.table + " (")
 		for i, columnDesc := range schema.columns {
-			// columnName := strings.SplitN(columnDesc, " ", 2)[0]
 			if i > 0 {
 				cmd.WriteString(", ")
 			}
@@ -47,6 +49,46 @@ func InitializeSchemata() error {
 		if _, err := db.Exec(cmdStr); err != nil {
 			return err
 		}
+		if err := migrateSchema(schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Adds columns introduced after the table was created.
+// New columns should come with a default value
+func migrateSchema(schema tableSchema) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info($1)", schema.table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	existing := map[string]struct{}{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		existing[name] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, columnDesc := range schema.columns {
+		columnName := strings.SplitN(columnDesc, " ", 2)[0]
+		switch columnName {
+		case "PRIMARY", "FOREIGN", "UNIQUE", "CHECK":
+			// Table constraints
+			continue
+		}
+		if _, ok := existing[columnName]; ok {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + schema.table + " ADD COLUMN " + columnDesc); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -194,11 +236,11 @@ func (u *User) Save() {
 }
 
 type Profile struct {
-	Id      int
-	Creator int
-	Details string
-	Stats   [8]int
-	Traits  []string
+	Id      int      `json:"id"`
+	Creator int      `json:"creator"`
+	Details string   `json:"details"`
+	Stats   [8]int   `json:"stats"`
+	Traits  []string `json:"traits"`
 }
 
 func init() {
@@ -225,6 +267,12 @@ func (p *Profile) Repr() OrderedKeysMarshal {
 	}
 }
 
+// Includes the growth balance, which takes a query over the ledger;
+// only for the profile endpoints, not for the room's player lists
+func (p *Profile) ReprWithGrowth() OrderedKeysMarshal {
+	return append(p.Repr(), OrderedKeysEntry{"growth_points", ProfileGrowthBalance(p.Id)})
+}
+
 func parseProfileStats(s string) ([8]int, error) {
 	stats := strings.Split(s, ",")
 	if len(stats) != 8 {
@@ -326,7 +374,7 @@ func ProfileListByCreatorRepr(creatorUserId int) []OrderedKeysMarshal {
 			panic(err)
 		}
 		p.Traits = parseProfileTraits(traits)
-		profiles = append(profiles, p.Repr())
+		profiles = append(profiles, p.ReprWithGrowth())
 	}
 	if err := rows.Err(); err != nil {
 		panic(err)
@@ -334,6 +382,143 @@ func ProfileListByCreatorRepr(creatorUserId int) []OrderedKeysMarshal {
 	return profiles
 }
 
+// Growth points credited at the end of games and spent on raising stats.
+// The balance of a profile is the sum of all its entries
+type GrowthLedgerEntry struct {
+	Id        int
+	Profile   int
+	Timestamp int64
+	Amount    int    // Positive for credits, negative for spends
+	Game      int    // Game that credited the points, 0 for spends
+	Stats     [8]int // Stats after spending, zero for credits
+}
+
+func init() {
+	registerSchema("growth_ledger",
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"profile INTEGER",
+		"timestamp INTEGER",
+		"amount INTEGER",
+		"game INTEGER",
+		"stats TEXT",
+		"FOREIGN KEY (profile) REFERENCES profile(id)",
+		"FOREIGN KEY (game) REFERENCES game(id)")
+}
+
+func (e *GrowthLedgerEntry) Repr() OrderedKeysMarshal {
+	return OrderedKeysMarshal{
+		{"id", e.Id},
+		{"timestamp", e.Timestamp},
+		{"amount", e.Amount},
+		{"game", nullIfZero(e.Game)},
+		{"stats", validOrNil(e.Game == 0, e.Stats)},
+	}
+}
+
+func ProfileGrowthBalance(profileId int) int {
+	var balance int
+	err := db.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0) FROM growth_ledger WHERE profile = $1`,
+		profileId,
+	).Scan(&balance)
+	if err != nil {
+		panic(err)
+	}
+	return balance
+}
+
+func ProfileGrowthCredit(profileId int, gameId int, amount int) {
+	_, err := db.Exec(
+		`INSERT INTO growth_ledger (profile, timestamp, amount, game) VALUES ($1, $2, $3, $4)`,
+		profileId, time.Now().Unix(), amount, gameId,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Raises the stats of the profile to `stats`, spending one growth point
+// for each point raised. Returns the number of points spent
+func (p *Profile) Grow(stats [8]int) (int, error) {
+	cost := 0
+	for i := range 8 {
+		if stats[i] < p.Stats[i] {
+			return 0, fmt.Errorf("Stats cannot be lowered")
+		}
+		cost += stats[i] - p.Stats[i]
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(err)
+	}
+	defer tx.Rollback()
+
+	var balance int
+	err = tx.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0) FROM growth_ledger WHERE profile = $1`,
+		p.Id,
+	).Scan(&balance)
+	if err != nil {
+		panic(err)
+	}
+	if balance < cost {
+		return 0, fmt.Errorf("Insufficient growth points (%d required, %d available)", cost, balance)
+	}
+
+	encodedStats := encodeProfileStats(stats)
+	if _, err := tx.Exec(
+		`UPDATE profile SET stats = $1 WHERE id = $2`,
+		encodedStats, p.Id,
+	); err != nil {
+		panic(err)
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO growth_ledger (profile, timestamp, amount, game, stats) VALUES ($1, $2, $3, NULL, $4)`,
+		p.Id, time.Now().Unix(), -cost, encodedStats,
+	); err != nil {
+		panic(err)
+	}
+	if err := tx.Commit(); err != nil {
+		panic(err)
+	}
+	p.Stats = stats
+	return cost, nil
+}
+
+// Entries with IDs less than `beforeId`, at most `limit` of them, latest first
+func GrowthLedgerList(profileId int, beforeId int, limit int) []GrowthLedgerEntry {
+	rows, err := db.Query(
+		`SELECT id, timestamp, amount, game, stats FROM growth_ledger `+
+			`WHERE profile = $1 AND id < $2 ORDER BY id DESC LIMIT $3`,
+		profileId, beforeId, limit,
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	entries := []GrowthLedgerEntry{}
+	for rows.Next() {
+		e := GrowthLedgerEntry{Profile: profileId}
+		var game sql.NullInt64
+		var stats sql.NullString
+		if err := rows.Scan(&e.Id, &e.Timestamp, &e.Amount, &game, &stats); err != nil {
+			panic(err)
+		}
+		e.Game = int(game.Int64)
+		if stats.Valid {
+			if e.Stats, err = parseProfileStats(stats.String); err != nil {
+				panic(err)
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return entries
+}
+
 func ProfileAnyByCreator(userId int) int {
 	var profileId int
 	err := db.QueryRow("SELECT id FROM profile WHERE creator = $1 LIMIT 1", userId).Scan(&profileId)
@@ -353,6 +538,10 @@ type Room struct {
 	Title       string
 	Tags        string
 	Description string
+	Visibility  string // "public", "unlisted" or "private"
+	Password    string // Hashed; empty if none
+	InviteCode  string // Private rooms only
+	Settings    GameSettings
 }
 
 func init() {
@@ -363,9 +552,54 @@ func init() {
 		"title TEXT",
 		"tags TEXT",
 		"description TEXT",
+		"visibility TEXT NOT NULL DEFAULT 'public'",
+		"password TEXT NOT NULL DEFAULT ''",
+		"invite_code TEXT NOT NULL DEFAULT ''",
+		"settings TEXT NOT NULL DEFAULT ''",
 		"FOREIGN KEY (creator) REFERENCES user(id)")
 }
 
+func (r *Room) SetPassword(password string) {
+	if password == "" {
+		r.Password = ""
+		return
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	r.Password = string(hashed)
+}
+
+// Whether a user presenting the given password or invite code may enter.
+// The creator and everyone in non-private rooms may always enter
+func (r *Room) Admits(userId int, password string, inviteCode string) bool {
+	if r.Creator == userId || r.Visibility != "private" {
+		return true
+	}
+	if inviteCode != "" && subtle.ConstantTimeCompare([]byte(inviteCode), []byte(r.InviteCode)) == 1 {
+		return true
+	}
+	if password != "" && r.Password != "" &&
+		bcrypt.CompareHashAndPassword([]byte(r.Password), []byte(password)) == nil {
+		return true
+	}
+	return false
+}
+
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func (r *Room) ResetInviteCode() {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	r.InviteCode = string(b)
+}
+
 func (r *Room) Repr() OrderedKeysMarshal {
 	creator := User{Id: r.Creator}
 	if !creator.LoadById() {
@@ -378,20 +612,27 @@ func (r *Room) Repr() OrderedKeysMarshal {
 		{"title", r.Title},
 		{"tags", strings.Split(r.Tags, ",")},
 		{"description", r.Description},
+		{"visibility", r.Visibility},
+		{"has_password", r.Visibility == "private" && r.Password != ""},
+		{"settings", r.Settings},
 	}
 }
 
 func (r *Room) Load() bool {
+	var settings string
 	err := db.QueryRow(
-		`SELECT creator, created_at, title, tags, description FROM room WHERE id = $1`,
+		`SELECT creator, created_at, title, tags, description, visibility, password, invite_code, settings `+
+			`FROM room WHERE id = $1`,
 		r.Id,
-	).Scan(&r.Creator, &r.CreatedAt, &r.Title, &r.Tags, &r.Description)
+	).Scan(&r.Creator, &r.CreatedAt, &r.Title, &r.Tags, &r.Description,
+		&r.Visibility, &r.Password, &r.InviteCode, &settings)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return false
 		}
 		panic(err)
 	}
+	r.Settings = DecodeGameSettings(settings)
 	return true
 }
 
@@ -403,17 +644,518 @@ func (r *Room) CreateHandle() string {
 	return strconv.FormatInt(val, 10)
 }
 
+// The creator is only written on creation; see `SaveCreator`
 func (r *Room) Save() {
 	err := db.QueryRow(
-		`INSERT OR REPLACE INTO room (id, creator, created_at, title, tags, description) `+
-			`VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		`INSERT INTO room `+
+			`(id, creator, created_at, title, tags, description, visibility, password, invite_code, settings) `+
+			`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) `+
+			`ON CONFLICT (id) DO UPDATE SET `+
+			`title = excluded.title, tags = excluded.tags, description = excluded.description, `+
+			`visibility = excluded.visibility, password = excluded.password, `+
+			`invite_code = excluded.invite_code, settings = excluded.settings `+
+			`RETURNING id`,
 		nullIfZero(r.Id), r.Creator, r.CreatedAt, r.Title, r.Tags, r.Description,
+		r.Visibility, r.Password, r.InviteCode, r.Settings.Encode(),
 	).Scan(&r.Id)
 	if err != nil {
 		panic(err)
 	}
 }
 
+func (r *Room) SaveCreator() {
+	if _, err := db.Exec(`UPDATE room SET creator = $1 WHERE id = $2`, r.Creator, r.Id); err != nil {
+		panic(err)
+	}
+}
+
+// Users banned from rooms by their creators
+func init() {
+	registerSchema("room_ban",
+		"room INTEGER",
+		"user INTEGER",
+		"created_at INTEGER",
+		"PRIMARY KEY (room, user)",
+		"FOREIGN KEY (room) REFERENCES room(id)",
+		"FOREIGN KEY (user) REFERENCES user(id)")
+}
+
+func RoomBanAdd(roomId int, userId int) {
+	_, err := db.Exec(
+		`INSERT OR IGNORE INTO room_ban (room, user, created_at) VALUES ($1, $2, $3)`,
+		roomId, userId, time.Now().Unix(),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func RoomBanRemove(roomId int, userId int) bool {
+	result, err := db.Exec(`DELETE FROM room_ban WHERE room = $1 AND user = $2`, roomId, userId)
+	if err != nil {
+		panic(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		panic(err)
+	}
+	return n > 0
+}
+
+func RoomBanned(roomId int, userId int) bool {
+	var n int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM room_ban WHERE room = $1 AND user = $2`,
+		roomId, userId,
+	).Scan(&n)
+	if err != nil {
+		panic(err)
+	}
+	return n > 0
+}
+
+func RoomBanList(roomId int) []User {
+	rows, err := db.Query(
+		`SELECT user.id, user.nickname FROM room_ban `+
+			`JOIN user ON user.id = room_ban.user `+
+			`WHERE room_ban.room = $1 ORDER BY room_ban.created_at ASC`,
+		roomId,
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Id, &u.Nickname); err != nil {
+			panic(err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return users
+}
+
+func init() {
+	registerSchema("game_log",
+		"room INTEGER",
+		"id INTEGER",
+		"timestamp INTEGER",
+		"content TEXT",
+		"PRIMARY KEY (room, id)",
+		"FOREIGN KEY (room) REFERENCES room(id)")
+}
+
+func (l *GameRoomLog) Save(roomId int) {
+	_, err := db.Exec(
+		`INSERT INTO game_log (room, id, timestamp, content) VALUES ($1, $2, $3, $4)`,
+		roomId, l.Id, l.Timestamp, l.Content,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func scanGameLogRows(rows *sql.Rows) []GameRoomLog {
+	defer rows.Close()
+	logs := []GameRoomLog{}
+	for rows.Next() {
+		var l GameRoomLog
+		if err := rows.Scan(&l.Id, &l.Timestamp, &l.Content); err != nil {
+			panic(err)
+		}
+		logs = append(logs, l)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return logs
+}
+
+// Entries with IDs greater than `afterId`, at most `limit` of them, in ascending order
+func GameLogListAfter(roomId int, afterId int, limit int) []GameRoomLog {
+	rows, err := db.Query(
+		`SELECT id, timestamp, content FROM game_log `+
+			`WHERE room = $1 AND id > $2 ORDER BY id ASC LIMIT $3`,
+		roomId, afterId, limit,
+	)
+	if err != nil {
+		panic(err)
+	}
+	return scanGameLogRows(rows)
+}
+
+// The latest entries with IDs less than `beforeId`, at most `limit` of them, in ascending order
+func GameLogListBefore(roomId int, beforeId int, limit int) []GameRoomLog {
+	rows, err := db.Query(
+		`SELECT id, timestamp, content FROM game_log `+
+			`WHERE room = $1 AND id < $2 ORDER BY id DESC LIMIT $3`,
+		roomId, beforeId, limit,
+	)
+	if err != nil {
+		panic(err)
+	}
+	logs := scanGameLogRows(rows)
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	return logs
+}
+
+type Game struct {
+	Id        int
+	Room      int
+	Seed      uint32
+	StartedAt int64
+	EndedAt   int64 // 0 if not ended
+}
+
+func init() {
+	registerSchema("game",
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"room INTEGER",
+		"seed INTEGER",
+		"started_at INTEGER",
+		"ended_at INTEGER",
+		"FOREIGN KEY (room) REFERENCES room(id)")
+}
+
+func (g *Game) Repr() OrderedKeysMarshal {
+	return OrderedKeysMarshal{
+		{"id", g.Id},
+		{"room", strconv.Itoa(g.Room)},
+		{"started_at", g.StartedAt},
+		{"ended_at", validOrNil(g.EndedAt != 0, g.EndedAt)},
+	}
+}
+
+func (g *Game) Save() {
+	err := db.QueryRow(
+		`INSERT OR REPLACE INTO game (id, room, seed, started_at, ended_at) `+
+			`VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		nullIfZero(g.Id), g.Room, g.Seed, g.StartedAt, validOrNil(g.EndedAt != 0, g.EndedAt),
+	).Scan(&g.Id)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (g *Game) Load() bool {
+	var endedAt sql.NullInt64
+	err := db.QueryRow(
+		`SELECT room, seed, started_at, ended_at FROM game WHERE id = $1`,
+		g.Id,
+	).Scan(&g.Room, &g.Seed, &g.StartedAt, &endedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false
+		}
+		panic(err)
+	}
+	g.EndedAt = endedAt.Int64
+	return true
+}
+
+// An entry in the ordered event stream of a game
+type GameEvent struct {
+	Game      int
+	Index     int
+	Timestamp int64
+	Type      string
+	UserId    int    // -1 for timeouts
+	Payload   string // JSON
+}
+
+func init() {
+	registerSchema("game_event",
+		"game INTEGER",
+		"idx INTEGER",
+		"timestamp INTEGER",
+		"type TEXT",
+		"user INTEGER",
+		"payload TEXT",
+		"PRIMARY KEY (game, idx)",
+		"FOREIGN KEY (game) REFERENCES game(id)")
+}
+
+func (e *GameEvent) Repr() OrderedKeysMarshal {
+	return OrderedKeysMarshal{
+		{"index", e.Index},
+		{"timestamp", e.Timestamp},
+		{"type", e.Type},
+		{"user_id", validOrNil(e.UserId != -1, e.UserId)},
+		{"is_timeout", e.UserId == -1},
+		{"payload", DirectMarshal(e.Payload)},
+	}
+}
+
+func (e *GameEvent) Save() {
+	_, err := db.Exec(
+		`INSERT INTO game_event (game, idx, timestamp, type, user, payload) `+
+			`VALUES ($1, $2, $3, $4, $5, $6)`,
+		e.Game, e.Index, e.Timestamp, e.Type, e.UserId, e.Payload,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func GameEventList(gameId int) []GameEvent {
+	rows, err := db.Query(
+		`SELECT idx, timestamp, type, user, payload FROM game_event `+
+			`WHERE game = $1 ORDER BY idx ASC`,
+		gameId,
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	events := []GameEvent{}
+	for rows.Next() {
+		e := GameEvent{Game: gameId}
+		if err := rows.Scan(&e.Index, &e.Timestamp, &e.Type, &e.UserId, &e.Payload); err != nil {
+			panic(err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return events
+}
+
+// A seat in a game, with its final results once the game has ended.
+// Each player taking over a seat has a row of their own, so that those who
+// left keep the game in their records
+type GameParticipant struct {
+	Game         int
+	Seat         int
+	Substitution int // 0 for the player seated at the start, then 1, 2, ...
+	User         int
+	Profile      int
+	Relationship [][3]float32 // nil if not ended
+	GrowthPoints int
+}
+
+func init() {
+	registerSchema("game_participant",
+		"game INTEGER",
+		"seat INTEGER",
+		"user INTEGER",
+		"profile INTEGER",
+		"relationship TEXT",
+		"growth_points INTEGER",
+		"substitution INTEGER DEFAULT 0",
+		"PRIMARY KEY (game, seat, substitution)",
+		"FOREIGN KEY (game) REFERENCES game(id)",
+		"FOREIGN KEY (user) REFERENCES user(id)",
+		"FOREIGN KEY (profile) REFERENCES profile(id)")
+}
+
+func (p *GameParticipant) Repr() OrderedKeysMarshal {
+	// Bots have negative IDs and no records of their own
+	if p.User < 0 {
+		return OrderedKeysMarshal{
+			{"seat", p.Seat},
+			{"substitution", p.Substitution},
+			{"user", nil},
+			{"profile", nil},
+			{"bot", true},
+			{"relationship", validOrNil(p.Relationship != nil, p.Relationship)},
+			{"growth_points", validOrNil(p.Relationship != nil, p.GrowthPoints)},
+		}
+	}
+	user := User{Id: p.User}
+	if !user.LoadById() {
+		panic("500 Inconsistent databases")
+	}
+	return OrderedKeysMarshal{
+		{"seat", p.Seat},
+		{"substitution", p.Substitution},
+		{"user", user.Repr()},
+		{"profile", p.Profile},
+		{"relationship", validOrNil(p.Relationship != nil, p.Relationship)},
+		{"growth_points", validOrNil(p.Relationship != nil, p.GrowthPoints)},
+	}
+}
+
+func (p *GameParticipant) Save() {
+	var relationship, growthPoints interface{}
+	if p.Relationship != nil {
+		relationshipJson, err := json.Marshal(p.Relationship)
+		if err != nil {
+			panic(err)
+		}
+		relationship = string(relationshipJson)
+		growthPoints = p.GrowthPoints
+	}
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO game_participant `+
+			`(game, seat, substitution, user, profile, relationship, growth_points) `+
+			`VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		p.Game, p.Seat, p.Substitution, p.User, p.Profile, relationship, growthPoints,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func GameParticipantList(gameId int) []GameParticipant {
+	rows, err := db.Query(
+		`SELECT seat, substitution, user, profile, relationship, growth_points FROM game_participant `+
+			`WHERE game = $1 ORDER BY seat ASC, substitution ASC`,
+		gameId,
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	participants := []GameParticipant{}
+	for rows.Next() {
+		p := GameParticipant{Game: gameId}
+		var relationship sql.NullString
+		var growthPoints sql.NullInt64
+		if err := rows.Scan(&p.Seat, &p.Substitution, &p.User, &p.Profile, &relationship, &growthPoints); err != nil {
+			panic(err)
+		}
+		if relationship.Valid {
+			if err := json.Unmarshal([]byte(relationship.String), &p.Relationship); err != nil {
+				panic(err)
+			}
+			p.GrowthPoints = int(growthPoints.Int64)
+		}
+		participants = append(participants, p)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return participants
+}
+
+// Substitution number of the player currently in the seat
+func GameParticipantLastSubstitution(gameId int, seat int) int {
+	var substitution sql.NullInt64
+	err := db.QueryRow(
+		`SELECT MAX(substitution) FROM game_participant WHERE game = $1 AND seat = $2`,
+		gameId, seat,
+	).Scan(&substitution)
+	if err != nil {
+		panic(err)
+	}
+	return int(substitution.Int64)
+}
+
+// Games with IDs less than `beforeId` where the given column of some seat matches,
+// at most `limit` of them, latest first
+func gameListByParticipant(column string, id int, beforeId int, limit int) []Game {
+	rows, err := db.Query(
+		`SELECT id, room, seed, started_at, ended_at FROM game `+
+			`WHERE id < $1 AND id IN (SELECT game FROM game_participant WHERE `+column+` = $2) `+
+			`ORDER BY id DESC LIMIT $3`,
+		beforeId, id, limit,
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	games := []Game{}
+	for rows.Next() {
+		var g Game
+		var endedAt sql.NullInt64
+		if err := rows.Scan(&g.Id, &g.Room, &g.Seed, &g.StartedAt, &endedAt); err != nil {
+			panic(err)
+		}
+		g.EndedAt = endedAt.Int64
+		games = append(games, g)
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return games
+}
+func GameListByUser(userId int, beforeId int, limit int) []Game {
+	return gameListByParticipant("user", userId, beforeId, limit)
+}
+func GameListByProfile(profileId int, beforeId int, limit int) []Game {
+	return gameListByParticipant("profile", profileId, beforeId, limit)
+}
+
+// Every version of game content that has been loaded, canonically encoded
+func init() {
+	registerSchema("content",
+		"version INTEGER PRIMARY KEY",
+		"data TEXT")
+}
+
+func ContentDataSave(version int, data string) {
+	_, err := db.Exec(`INSERT INTO content (version, data) VALUES ($1, $2)`, version, data)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func ContentDataLoad(version int) (string, bool) {
+	var data string
+	err := db.QueryRow(`SELECT data FROM content WHERE version = $1`, version).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false
+		}
+		panic(err)
+	}
+	return data, true
+}
+
+// Serialized state of a live room, kept across server restarts
+func init() {
+	registerSchema("room_snapshot",
+		"room INTEGER PRIMARY KEY",
+		"saved_at INTEGER",
+		"data TEXT",
+		"FOREIGN KEY (room) REFERENCES room(id)")
+}
+
+func RoomSnapshotSave(roomId int, data string) {
+	_, err := db.Exec(
+		`INSERT OR REPLACE INTO room_snapshot (room, saved_at, data) `+
+			`VALUES ($1, $2, $3)`,
+		roomId, time.Now().Unix(), data,
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func RoomSnapshotDelete(roomId int) {
+	if _, err := db.Exec(`DELETE FROM room_snapshot WHERE room = $1`, roomId); err != nil {
+		panic(err)
+	}
+}
+
+func RoomSnapshotList() map[int]string {
+	rows, err := db.Query(`SELECT room, data FROM room_snapshot`)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	snapshots := map[int]string{}
+	for rows.Next() {
+		var roomId int
+		var data string
+		if err := rows.Scan(&roomId, &data); err != nil {
+			panic(err)
+		}
+		snapshots[roomId] = data
+	}
+	if err := rows.Err(); err != nil {
+		panic(err)
+	}
+	return snapshots
+}
+
 func ReadEverything(w io.Writer) {
 	fmt.Fprintf(w, `
 <style>
@@ -427,7 +1169,7 @@ table, th, td {
 }
 </style>
 `)
-	tables := []string{"user", "profile", "room"}
+	tables := []string{"user", "profile", "room", "game_log", "game", "game_participant", "game_event", "growth_ledger", "room_ban", "room_snapshot"}
 	for _, table := range tables {
 		fmt.Fprintf(w, "<h2>%s</h2>\n<table>\n", table)
 		rows, err := db.Query(`SELECT * FROM ` + table)
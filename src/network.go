@@ -8,14 +8,18 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"net/http/pprof"
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -64,7 +68,7 @@ func validateAuthToken(token string) int {
 	}
 	return userId
 }
-func auth(w http.ResponseWriter, r *http.Request) User {
+func authUserId(r *http.Request) int {
 	cookies := r.Cookies()
 	var cookieValue string
 	for _, cookie := range cookies {
@@ -81,9 +85,13 @@ func auth(w http.ResponseWriter, r *http.Request) User {
 		}
 	}
 	if cookieValue == "" {
-		panic("401 Authentication required")
+		return 0
 	}
-	userId := validateAuthToken(cookieValue)
+	return validateAuthToken(cookieValue)
+}
+
+func auth(w http.ResponseWriter, r *http.Request) User {
+	userId := authUserId(r)
 	if userId == 0 {
 		panic("401 Authentication required")
 	}
@@ -94,6 +102,19 @@ func auth(w http.ResponseWriter, r *http.Request) User {
 	return user
 }
 
+// For public endpoints; returns a zero User (Id 0) when not logged in
+func authOptional(w http.ResponseWriter, r *http.Request) User {
+	userId := authUserId(r)
+	if userId == 0 {
+		return User{}
+	}
+	user := User{Id: userId}
+	if !user.LoadById() {
+		panic("500 Inconsistent databases")
+	}
+	return user
+}
+
 ////// Miscellaneous communication //////
 
 func parseIntFromPathValue(r *http.Request, key string) int {
@@ -116,6 +137,18 @@ func postFormValue(r *http.Request, key string, mandatory bool) (string, bool) {
 	}
 }
 
+func parseIntFromQueryValue(r *http.Request, key string, defaultValue int) int {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		panic("400 Incorrect `" + key + "`")
+	}
+	return n
+}
+
 func parseIntFromPostFormValue(r *http.Request, key string) int {
 	value, _ := postFormValue(r, key, true)
 	n, err := strconv.Atoi(value)
@@ -223,6 +256,10 @@ func profileCUHandler(w http.ResponseWriter, r *http.Request, createNew bool) {
 		profile.Details = details
 	}
 	if stats, has := postFormValue(r, "stats", createNew); has {
+		// Afterwards stats only rise by spending growth points
+		if !createNew {
+			panic("400 `stats` can only be set on creation")
+		}
 		var err error
 		profile.Stats, err = parseProfileStats(stats)
 		if err != nil {
@@ -234,7 +271,7 @@ func profileCUHandler(w http.ResponseWriter, r *http.Request, createNew bool) {
 	}
 
 	profile.Save()
-	write(w, 200, profile.Repr())
+	write(w, 200, profile.ReprWithGrowth())
 }
 func profileCreateHandler(w http.ResponseWriter, r *http.Request) {
 	profileCUHandler(w, r, true)
@@ -271,8 +308,60 @@ func profileGetHandler(w http.ResponseWriter, r *http.Request) {
 		panic("403 Not creator")
 	} */
 
-	write(w, 200, profile.Repr())
+	write(w, 200, profile.ReprWithGrowth())
 }
+func profileGrowHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth(w, r)
+
+	profile := Profile{Id: parseIntFromPathValue(r, "profile_id")}
+	if !profile.Load() {
+		panic("404 No such profile")
+	}
+	if profile.Creator != user.Id {
+		panic("403 Not creator")
+	}
+
+	if err := r.ParseForm(); err != nil {
+		panic("400 Incorrect form format")
+	}
+	statsStr, _ := postFormValue(r, "stats", true)
+	stats, err := parseProfileStats(statsStr)
+	if err != nil {
+		panic("400 " + err.Error())
+	}
+	if _, err := profile.Grow(stats); err != nil {
+		panic("400 " + err.Error())
+	}
+	write(w, 200, profile.ReprWithGrowth())
+}
+
+func profileGrowthLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth(w, r)
+
+	profile := Profile{Id: parseIntFromPathValue(r, "profile_id")}
+	if !profile.Load() {
+		panic("404 No such profile")
+	}
+	if profile.Creator != user.Id {
+		panic("403 Not creator")
+	}
+
+	beforeId := parseIntFromQueryValue(r, "before", math.MaxInt)
+	limit := parseIntFromQueryValue(r, "limit", 20)
+	if limit <= 0 || limit > 100 {
+		panic("400 Incorrect `limit`")
+	}
+
+	entryReprs := []OrderedKeysMarshal{}
+	for _, entry := range GrowthLedgerList(profile.Id, beforeId, limit) {
+		entryReprs = append(entryReprs, entry.Repr())
+	}
+	write(w, 200, OrderedKeysMarshal{
+		{"growth_points", ProfileGrowthBalance(profile.Id)},
+		{"ledger", entryReprs},
+	})
+}
+
 func avatarHandler(w http.ResponseWriter, r *http.Request) {
 	handle := r.PathValue("profile_id")
 	fmt.Fprintln(w, "avatar "+handle)
@@ -293,6 +382,7 @@ func roomCUHandler(w http.ResponseWriter, r *http.Request, createNew bool) {
 	if createNew {
 		room.Creator = user.Id
 		room.CreatedAt = time.Now().Unix()
+		room.Settings = DefaultGameSettings()
 	} else {
 		room.Id = parseIntFromPathValue(r, "room_id")
 		if !room.Load() {
@@ -312,17 +402,48 @@ func roomCUHandler(w http.ResponseWriter, r *http.Request, createNew bool) {
 	if description, has := postFormValue(r, "description", createNew); has {
 		room.Description = description
 	}
+	if visibility, has := postFormValue(r, "visibility", false); has {
+		if visibility != "public" && visibility != "unlisted" && visibility != "private" {
+			panic("400 Incorrect `visibility`")
+		}
+		room.Visibility = visibility
+	} else if createNew {
+		room.Visibility = "public"
+	}
+	if password, has := postFormValue(r, "password", false); has {
+		room.SetPassword(password)
+	}
+	if settings, has := postFormValue(r, "settings", false); has {
+		// Games keep the settings they started with
+		if !createNew && GameRoomState(room.Id) == RoomStateInGame {
+			panic("403 Game in progress")
+		}
+		merged, err := room.Settings.Merge(settings)
+		if err != nil {
+			panic("400 Incorrect `settings`: " + err.Error())
+		}
+		room.Settings = merged
+	}
+	if room.Visibility == "private" {
+		_, resetInviteCode := postFormValue(r, "reset_invite_code", false)
+		if room.InviteCode == "" || resetInviteCode {
+			room.ResetInviteCode()
+		}
+	} else {
+		room.InviteCode = ""
+	}
 
 	room.Save()
+	GameRoomUpdate(room)
 
 	if createNew {
-		go GameRoomRun(room, nil)
+		go GameRoomRun(room, nil, nil)
 		if Config.Debug {
 			log.Printf("Visit http://localhost:%d/test/%d/%d for testing\n", Config.Port, room.Id, user.Id)
 		}
 	}
 
-	write(w, 200, room.Repr())
+	write(w, 200, roomReprForUser(room, user.Id))
 }
 func roomCreateHandler(w http.ResponseWriter, r *http.Request) {
 	roomCUHandler(w, r, true)
@@ -331,14 +452,251 @@ func roomUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	roomCUHandler(w, r, false)
 }
 
+// The invite code is only shown to the creator
+func roomReprForUser(room Room, userId int) OrderedKeysMarshal {
+	repr := room.Repr()
+	if room.Creator == userId {
+		repr = append(repr, OrderedKeysEntry{"invite_code", validOrNil(room.InviteCode != "", room.InviteCode)})
+	}
+	return repr
+}
+
+// Private rooms require a password or an invite code in the query
+func roomAccessCheck(r *http.Request, user User, room Room) {
+	query := r.URL.Query()
+	if !room.Admits(user.Id, query.Get("password"), query.Get("invite_code")) {
+		panic("403 Incorrect password or invite code")
+	}
+}
+
 func roomGetHandler(w http.ResponseWriter, r *http.Request) {
+	user := authOptional(w, r)
+
 	room := Room{
 		Id: parseIntFromPathValue(r, "room_id"),
 	}
 	if !room.Load() {
 		panic("404 No such room")
 	}
-	write(w, 200, room.Repr())
+	roomAccessCheck(r, user, room)
+	repr := roomReprForUser(room, user.Id)
+	repr = append(repr, OrderedKeysEntry{"state", GameRoomState(room.Id)})
+	write(w, 200, repr)
+}
+
+func roomListHandler(w http.ResponseWriter, r *http.Request) {
+	_ = auth(w, r)
+
+	query := r.URL.Query()
+	tag := query.Get("tag")
+	phase := query.Get("phase")
+	if phase != "" && phase != "assembly" && phase != "appointment" && phase != "gameplay" {
+		panic("400 Incorrect `phase`")
+	}
+	order := query.Get("order")
+	if order == "" {
+		order = "desc"
+	} else if order != "asc" && order != "desc" {
+		panic("400 Incorrect `order`")
+	}
+	limit := parseIntFromQueryValue(r, "limit", 20)
+	if limit <= 0 || limit > 100 {
+		panic("400 Incorrect `limit`")
+	}
+
+	// Cursor: creation time and ID of the last room on the previous page
+	// Rooms are ordered by creation time, with ties broken by ID
+	before := func(a, b Room) bool {
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return a.Id < b.Id
+	}
+	var cursor *Room
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		createdAtStr, idStr, ok := strings.Cut(cursorStr, "_")
+		createdAt, err1 := strconv.ParseInt(createdAtStr, 10, 64)
+		id, err2 := strconv.Atoi(idStr)
+		if !ok || err1 != nil || err2 != nil {
+			panic("400 Incorrect `cursor`")
+		}
+		cursor = &Room{Id: id, CreatedAt: createdAt}
+	}
+
+	summaries := []GameRoomSummary{}
+	for _, s := range GameRoomListOpen() {
+		if !s.Listed() {
+			continue
+		}
+		if phase != "" && s.Phase != phase {
+			continue
+		}
+		if tag != "" && !slices.Contains(strings.Split(s.Room.Tags, ","), tag) {
+			continue
+		}
+		if cursor != nil {
+			if order == "asc" && !before(*cursor, s.Room) ||
+				order == "desc" && !before(s.Room, *cursor) {
+				continue
+			}
+		}
+		summaries = append(summaries, s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if order == "asc" {
+			return before(summaries[i].Room, summaries[j].Room)
+		} else {
+			return before(summaries[j].Room, summaries[i].Room)
+		}
+	})
+
+	var nextCursor interface{}
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+		last := summaries[limit-1].Room
+		nextCursor = fmt.Sprintf("%d_%d", last.CreatedAt, last.Id)
+	}
+	roomReprs := []OrderedKeysMarshal{}
+	for _, s := range summaries {
+		roomReprs = append(roomReprs, s.Repr())
+	}
+	write(w, 200, OrderedKeysMarshal{
+		{"rooms", roomReprs},
+		{"next_cursor", nextCursor},
+	})
+}
+
+func roomLogHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth(w, r)
+
+	room := Room{
+		Id: parseIntFromPathValue(r, "room_id"),
+	}
+	if !room.Load() {
+		panic("404 No such room")
+	}
+	roomAccessCheck(r, user, room)
+
+	afterId := parseIntFromQueryValue(r, "after", -1)
+	limit := parseIntFromQueryValue(r, "limit", 100)
+	if limit <= 0 || limit > 500 {
+		panic("400 Incorrect `limit`")
+	}
+
+	logReprs := []OrderedKeysMarshal{}
+	for _, entry := range GameLogListAfter(room.Id, afterId, limit) {
+		logReprs = append(logReprs, entry.Repr())
+	}
+	write(w, 200, logReprs)
+}
+
+func gameReplayHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth(w, r)
+
+	game := Game{Id: parseIntFromPathValue(r, "game_id")}
+	if !game.Load() {
+		panic("404 No such game")
+	}
+	// Hands are private during play
+	if GameInProgress(game) {
+		panic("403 Game in progress")
+	}
+
+	events := GameEventList(game.Id)
+	// Those who took a seat at any point may view any seat;
+	// others are let in as to the room, and only as spectators
+	participant := false
+	for _, event := range events {
+		if (event.Type == "seat" || event.Type == "substitute") && event.UserId == user.Id {
+			participant = true
+			break
+		}
+	}
+	if !participant {
+		room := Room{Id: game.Room}
+		if !room.Load() {
+			panic("404 No such room")
+		}
+		roomAccessCheck(r, user, room)
+	}
+
+	index := parseIntFromQueryValue(r, "index", len(events))
+	if index < 0 || index > len(events) {
+		panic("400 Incorrect `index`")
+	}
+	state, err := GameplayReplayEvents(events[:index])
+	if err != "" {
+		panic("500 Inconsistent game records: " + err)
+	}
+
+	// Seat from whose perspective the state is represented;
+	// by default the caller's own, or a spectator's (user ID 0) if not seated
+	userId := 0
+	if state.PlayerIndex(user.Id) != -1 {
+		userId = user.Id
+	}
+	if r.URL.Query().Get("seat") != "" {
+		if !participant {
+			panic("403 Not a participant")
+		}
+		seat := parseIntFromQueryValue(r, "seat", -1)
+		if seat < 0 || seat >= len(state.Players) {
+			panic("400 Incorrect `seat`")
+		}
+		userId = state.Players[seat].User.Id
+	}
+
+	var lastEvent interface{}
+	if index > 0 {
+		lastEvent = events[index-1].Repr()
+	}
+	entries := OrderedKeysMarshal{
+		{"game", game.Repr()},
+		{"index", index},
+		{"event_count", len(events)},
+		{"event", lastEvent},
+		{"my_index", state.PlayerIndexNullable(userId)},
+	}
+	entries = append(entries, state.Repr(nil, userId)...)
+	write(w, 200, entries)
+}
+
+func gameListRepr(r *http.Request, list func(beforeId int, limit int) []Game) []OrderedKeysMarshal {
+	beforeId := parseIntFromQueryValue(r, "before", math.MaxInt)
+	limit := parseIntFromQueryValue(r, "limit", 20)
+	if limit <= 0 || limit > 100 {
+		panic("400 Incorrect `limit`")
+	}
+
+	gameReprs := []OrderedKeysMarshal{}
+	for _, game := range list(beforeId, limit) {
+		participantReprs := []OrderedKeysMarshal{}
+		for _, p := range GameParticipantList(game.Id) {
+			participantReprs = append(participantReprs, p.Repr())
+		}
+		gameReprs = append(gameReprs, append(game.Repr(),
+			OrderedKeysEntry{"participants", participantReprs}))
+	}
+	return gameReprs
+}
+
+func gameListMyHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth(w, r)
+	write(w, 200, gameListRepr(r, func(beforeId int, limit int) []Game {
+		return GameListByUser(user.Id, beforeId, limit)
+	}))
+}
+
+func gameListByProfileHandler(w http.ResponseWriter, r *http.Request) {
+	_ = auth(w, r)
+
+	profile := Profile{Id: parseIntFromPathValue(r, "profile_id")}
+	if !profile.Load() {
+		panic("404 No such profile")
+	}
+	write(w, 200, gameListRepr(r, func(beforeId int, limit int) []Game {
+		return GameListByProfile(profile.Id, beforeId, limit)
+	}))
 }
 
 var upgrader = websocket.Upgrader{
@@ -355,12 +713,37 @@ func roomChannelHandler(w http.ResponseWriter, r *http.Request) {
 		panic("404 No such room")
 	}
 
+	// Sequence number of the last message received before the connection dropped
+	lastSeq := parseIntFromQueryValue(r, "last_seq", -1)
+	if lastSeq < -1 {
+		panic("400 Incorrect `last_seq`")
+	}
+
+	// Spectators watch the game without taking a seat
+	var spectator bool
+	switch r.URL.Query().Get("role") {
+	case "", "player":
+		spectator = false
+	case "spectator":
+		spectator = true
+	default:
+		panic("400 Incorrect `role`")
+	}
+
+	if RoomBanned(room.Id, user.Id) {
+		panic("403 Banned from room")
+	}
+
 	gameRoom := GameRoomFind(room.Id)
+	// Those who have entered may come back without the password or invite code
+	if gameRoom == nil || !gameRoom.HasJoined(user.Id) {
+		roomAccessCheck(r, user, room)
+	}
 	if gameRoom == nil {
 		if room.Creator == user.Id {
 			// Reopen room
 			createdSignal := make(chan *GameRoom)
-			go GameRoomRun(room, createdSignal)
+			go GameRoomRun(room, nil, createdSignal)
 			gameRoom = <-createdSignal
 		} else {
 			panic("404 Room closed")
@@ -382,16 +765,19 @@ func roomChannelHandler(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// `outChannel`: messages to be sent to the client
-	outChannel := make(chan interface{}, 4)
+	// Sized to hold a full replay without blocking the room
+	outChannel := make(chan interface{}, GameRoomReplayLimit+4)
 
 	// Add to the room
-	gameRoom.Join(user, outChannel)
+	gameRoom.Join(user, outChannel, lastSeq, spectator)
 
 	// Goroutine that keeps reading JSON from the WebSocket connection
 	// and pushes them to `inChannel`
 	go func(c *websocket.Conn) {
-		var object map[string]interface{}
 		for {
+			// A fresh map for each message, as the previous one is
+			// still being processed by the room
+			var object map[string]interface{}
 			if err := c.ReadJSON(&object); err != nil {
 				if !websocket.IsCloseError(err,
 					websocket.CloseNormalClosure,
@@ -444,6 +830,71 @@ func roomChannelHandler(w http.ResponseWriter, r *http.Request) {
 	}(c, outChannel)
 }
 
+func lobbyChannelHandler(w http.ResponseWriter, r *http.Request) {
+	_ = auth(w, r)
+
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	c.SetReadLimit(4096)
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	c.SetPongHandler(func(string) error {
+		c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		return nil
+	})
+
+	outChannel := make(chan interface{}, LobbyOutboxSize)
+	Lobby.Join(outChannel)
+
+	// Nothing is expected from the client; keep reading to handle pongs and closure
+	go func(c *websocket.Conn) {
+		for {
+			if _, _, err := c.NextReader(); err != nil {
+				break
+			}
+		}
+		Lobby.Leave(outChannel)
+	}(c)
+
+	go func(c *websocket.Conn, outChannel chan interface{}) {
+		pingTicker := time.NewTicker(5 * time.Second)
+		defer pingTicker.Stop()
+
+	messageLoop:
+		for {
+			select {
+			case object, ok := <-outChannel:
+				if !ok {
+					// Closed by the lobby
+					break messageLoop
+				}
+				if err := c.WriteJSON(object); err != nil {
+					log.Println(err)
+					break messageLoop
+				}
+
+			case <-pingTicker.C:
+				if err := c.WriteMessage(websocket.PingMessage, nil); err != nil {
+					log.Println(err)
+					break messageLoop
+				}
+			}
+		}
+
+		Lobby.Leave(outChannel)
+		c.Close()
+	}(c, outChannel)
+}
+
+// Server time, for clients to correct for clock skew against deadlines
+func timeHandler(w http.ResponseWriter, r *http.Request) {
+	write(w, 200, OrderedKeysMarshal{
+		{"time", time.Now().UnixMilli()},
+	})
+}
+
 func versionInfoHandler(w http.ResponseWriter, r *http.Request) {
 	var vcsRev string
 	var vcsTime string
@@ -562,10 +1013,12 @@ func (h *corsAllowAllHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 func ServerListen() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /", versionInfoHandler)
+	mux.HandleFunc("GET /time", timeHandler)
 
 	mux.HandleFunc("POST /sign-up", signUpHandler)
 	mux.HandleFunc("POST /log-in", logInHandler)
 	mux.HandleFunc("GET /me", meHandler)
+	mux.HandleFunc("GET /me/games", gameListMyHandler)
 
 	mux.HandleFunc("POST /profile/create", profileCreateHandler)
 	mux.HandleFunc("POST /profile/{profile_id}/update", profileUpdateHandler)
@@ -573,12 +1026,20 @@ func ServerListen() {
 	mux.HandleFunc("GET /profile/{profile_id}", profileGetHandler)
 	mux.HandleFunc("GET /profile/{profile_id}/avatar", avatarHandler)
 	mux.HandleFunc("GET /profile/my", profileListMyHandler)
+	mux.HandleFunc("GET /profile/{profile_id}/games", gameListByProfileHandler)
+	mux.HandleFunc("POST /profile/{profile_id}/grow", profileGrowHandler)
+	mux.HandleFunc("GET /profile/{profile_id}/growth", profileGrowthLedgerHandler)
 
+	mux.HandleFunc("GET /rooms", roomListHandler)
+	mux.HandleFunc("GET /lobby/channel", lobbyChannelHandler)
 	mux.HandleFunc("POST /room/create", roomCreateHandler)
 	mux.HandleFunc("POST /room/{room_id}/update", roomUpdateHandler)
 	mux.HandleFunc("GET /room/{room_id}", roomGetHandler)
+	mux.HandleFunc("GET /room/{room_id}/log", roomLogHandler)
 	mux.HandleFunc("GET /room/{room_id}/channel", roomChannelHandler)
 
+	mux.HandleFunc("GET /game/{game_id}/replay", gameReplayHandler)
+
 	var handler http.Handler
 	handler = &errCaptureHandler{Handler: mux}
 
@@ -615,8 +1076,19 @@ func ServerListen() {
 		}
 	}()
 
+	// Reload content on SIGHUP; games in progress keep their content
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := LoadContent(); err != nil {
+				log.Printf("Content not reloaded: %v\n", err)
+			}
+		}
+	}()
+
 	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
 	<-ch
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -624,5 +1096,6 @@ func ServerListen() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Print(err)
 	}
+	GameRoomSnapshotAll()
 	log.Print("Shutting down")
 }
@@ -1,13 +1,34 @@
 package main
 
-var seed = uint32(1)
+import (
+	"crypto/rand"
+	"encoding/binary"
+)
 
-func CloudRandomU16() uint16 {
-	seed = uint32(uint64(seed)*1103515245 + 12345)
-	return uint16(seed >> 15)
+// A linear congruential generator owned by each game,
+// so that a game can be reproduced from its seed
+type CloudRandom struct {
+	State uint32
 }
 
-func CloudRandom(max int) int {
+func NewCloudRandom(seed uint32) *CloudRandom {
+	return &CloudRandom{State: seed}
+}
+
+func CloudRandomSeed() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.LittleEndian.Uint32(b[:])
+}
+
+func (r *CloudRandom) U16() uint16 {
+	r.State = uint32(uint64(r.State)*1103515245 + 12345)
+	return uint16(r.State >> 15)
+}
+
+func (r *CloudRandom) Int(max int) int {
 	// FIXME: Discard and re-flip for better uniformity
-	return int(CloudRandomU16()) % max
+	return int(r.U16()) % max
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+////// Game settings //////
+// Time limits and game structure, adjustable per room.
+// A game keeps the settings it was started with
+
+// Time limits are given in whole seconds
+type Seconds int
+
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+type GameSettings struct {
+	TimeLimitAppointment      Seconds `json:"time_limit_appointment"`
+	TimeLimitCardSelection    Seconds `json:"time_limit_card_selection"`
+	TimeLimitStorytelling     Seconds `json:"time_limit_storytelling"`
+	TimeLimitStorytellingCont Seconds `json:"time_limit_storytelling_cont"`
+	// Extra time each player may draw on during the game, see `GameplayTimeBankStep`
+	TimeBank Seconds `json:"time_bank"`
+	HandSize int     `json:"hand_size"`
+	// The arena holds at least one keyword for each player
+	ArenaSize int `json:"arena_size"`
+	// Number of rounds in each act
+	ActRounds []int `json:"act_rounds"`
+	// Seats available, and those to be taken before starting
+	MinPlayers int `json:"min_players"`
+	MaxPlayers int `json:"max_players"`
+}
+
+func DefaultGameSettings() GameSettings {
+	return GameSettings{
+		TimeLimitAppointment:      30,
+		TimeLimitCardSelection:    60,
+		TimeLimitStorytelling:     180,
+		TimeLimitStorytellingCont: 120,
+		TimeBank:                  60,
+		HandSize:                  5,
+		ArenaSize:                 3,
+		ActRounds:                 []int{1, 2, 1, 1},
+		MinPlayers:                2,
+		MaxPlayers:                8,
+	}
+}
+
+const SettingsMinTimeLimit = 5
+const SettingsMaxTimeLimit = 3600
+const SettingsMaxHandSize = 10
+const SettingsMaxArenaSize = 20
+const SettingsMaxActs = 10
+const SettingsMaxRoundsPerAct = 10
+
+// With fewer than two, there is nobody to appoint or to relate to
+const SettingsMinPlayers = 2
+const SettingsMaxPlayers = 20
+
+// Applies a (possibly partial) JSON object on top of the settings
+func (c GameSettings) Merge(data string) (GameSettings, error) {
+	c.ActRounds = append([]int{}, c.ActRounds...)
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		return c, err
+	}
+	return c, c.Validate()
+}
+
+func (c GameSettings) Validate() error {
+	for _, t := range []Seconds{
+		c.TimeLimitAppointment, c.TimeLimitCardSelection,
+		c.TimeLimitStorytelling, c.TimeLimitStorytellingCont,
+	} {
+		if t < SettingsMinTimeLimit || t > SettingsMaxTimeLimit {
+			return fmt.Errorf("Time limits should be between %d and %d seconds",
+				SettingsMinTimeLimit, SettingsMaxTimeLimit)
+		}
+	}
+	if c.TimeBank < 0 || c.TimeBank > SettingsMaxTimeLimit {
+		return fmt.Errorf("Time bank should be between 0 and %d seconds", SettingsMaxTimeLimit)
+	}
+	if c.HandSize < 1 || c.HandSize > SettingsMaxHandSize {
+		return fmt.Errorf("Hand size should be between 1 and %d", SettingsMaxHandSize)
+	}
+	if c.ArenaSize < 1 || c.ArenaSize > SettingsMaxArenaSize {
+		return fmt.Errorf("Arena size should be between 1 and %d", SettingsMaxArenaSize)
+	}
+	if len(c.ActRounds) < 1 || len(c.ActRounds) > SettingsMaxActs {
+		return fmt.Errorf("There should be between 1 and %d acts", SettingsMaxActs)
+	}
+	for _, n := range c.ActRounds {
+		if n < 1 || n > SettingsMaxRoundsPerAct {
+			return fmt.Errorf("Each act should have between 1 and %d rounds", SettingsMaxRoundsPerAct)
+		}
+	}
+	if c.MinPlayers < SettingsMinPlayers || c.MaxPlayers > SettingsMaxPlayers || c.MinPlayers > c.MaxPlayers {
+		return fmt.Errorf("Number of players should be between %d and %d, with minimum not above maximum",
+			SettingsMinPlayers, SettingsMaxPlayers)
+	}
+	return nil
+}
+
+// Stored as JSON; missing entries (including the whole object, for rooms
+// created before settings existed) take the defaults
+func (c GameSettings) Encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+func DecodeGameSettings(data string) GameSettings {
+	c := DefaultGameSettings()
+	if data == "" {
+		return c
+	}
+	if err := json.Unmarshal([]byte(data), &c); err != nil {
+		panic(err)
+	}
+	return c
+}